@@ -2,6 +2,7 @@ package fiberextend
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"reflect"
 	"regexp"
@@ -17,6 +18,8 @@ type IMeta struct {
 	Page    int    `json:"page,omitempty"`    // ページ数
 	Current int    `json:"current,omitempty"` // 現在のページ
 	Elapsed string `json:"elapsed,omitempty"` // 所要時間
+	Next    string `json:"next,omitempty"`    // 次ページのカーソル
+	Prev    string `json:"prev,omitempty"`    // 前ページのカーソル
 }
 
 type IError struct {
@@ -44,6 +47,8 @@ func (p *IFiberEx) MetaMiddleware() func(*fiber.Ctx) error {
 		c.Locals("total_count", int64(0))
 		c.Locals("page_max", 0)
 		c.Locals("page_current", 0)
+		c.Locals("cursor_next", "")
+		c.Locals("cursor_prev", "")
 		c.Locals("userid", "-")
 		return c.Next()
 	}
@@ -56,17 +61,31 @@ func (p *IFiberEx) NewMeta(c *fiber.Ctx) *IMeta {
 		Page:    c.Locals("page_max").(int),
 		Current: c.Locals("page_current").(int),
 		Elapsed: stop.Sub(c.Locals("start_time").(time.Time)).String(),
+		Next:    c.Locals("cursor_next").(string),
+		Prev:    c.Locals("cursor_prev").(string),
 	}
 }
 
 func (p *IFiberEx) result(c *fiber.Ctx, code int, body *IResponse) error {
 	body.Meta = p.NewMeta(c)
-	rs, err := json.Marshal(body)
+	mime, encode := negotiateEncoder(c)
+	c.Vary(fiber.HeaderAccept)
+	if p.Config.UseETag && code == 200 {
+		if sent, err := p.resultETag(c, body, mime); err != nil {
+			return c.SendStatus(500)
+		} else if sent {
+			return nil
+		}
+	}
+	rs, err := encode(body)
 	if err != nil {
 		return c.SendStatus(500)
 	}
-	c.Response().Header.Add("Content-Type", "application/json; charset=utf-8")
-	return c.Status(code).SendString(string(rs))
+	if strings.HasPrefix(mime, "text/") || strings.HasSuffix(mime, "json") {
+		mime += "; charset=utf-8"
+	}
+	c.Set(fiber.HeaderContentType, mime)
+	return c.Status(code).Send(rs)
 }
 
 func (p *IFiberEx) ResultError(c *fiber.Ctx, code int, err error, errors ...IError) error {
@@ -75,11 +94,27 @@ func (p *IFiberEx) ResultError(c *fiber.Ctx, code int, err error, errors ...IErr
 	} else {
 		p.Log.With(p.LogCaller()).Error(fmt.Sprintf("api error: %s", err), p.ApiErrorLogFields(c, err)...)
 	}
+	if code >= 400 && p.useProblem(c) {
+		return p.resultProblem(c, code, errors...)
+	}
 	return p.result(c, code, &IResponse{
 		Errors: errors,
 	})
 }
 
+// エラーの種類に応じたステータスとエラーを返す IAppError以外は500
+func (p *IFiberEx) ResultAppError(c *fiber.Ctx, err error) error {
+	var appErr *IAppError
+	if errors.As(err, &appErr) {
+		return p.ResultError(c, appErr.Code.Status(), err, appErr.LocalizedErrors(p.Lang(c))...)
+	}
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) { // ルートが見つからない場合等
+		return p.ResultError(c, fiberErr.Code, err, IError{Code: string(E99999), Message: fiberErr.Message})
+	}
+	return p.ResultError(c, 500, err, E99999.LocalizedErrors(p.Lang(c))...)
+}
+
 func (p *IFiberEx) Result(c *fiber.Ctx, code int, results ...interface{}) error {
 	if c.Response().StatusCode() > 300 { // レスポンスがすでに設定されている場合は何もしない
 		return nil
@@ -95,6 +130,7 @@ func (p *IFiberEx) Result(c *fiber.Ctx, code int, results ...interface{}) error
 
 // Deprecated: should not be used
 func (p *IFiberEx) RequestParser(c *fiber.Ctx, params interface{}) bool {
+	p.docRoute(c, IRouteDoc{Request: params})
 	if c.Method() == "GET" {
 		if err := c.QueryParser(params); err != nil {
 			if err := p.ResultError(c, 400, err); err == nil {
@@ -108,7 +144,7 @@ func (p *IFiberEx) RequestParser(c *fiber.Ctx, params interface{}) bool {
 			}
 		}
 	}
-	if err := p.Validation(params); len(err) > 0 {
+	if err := p.LocalizedValidation(c, params); len(err) > 0 {
 		if err := p.ResultError(c, 400, fmt.Errorf("validation error: %+v", err), err...); err == nil {
 			return false
 		}
@@ -117,6 +153,8 @@ func (p *IFiberEx) RequestParser(c *fiber.Ctx, params interface{}) bool {
 }
 
 func RequestParser[T comparable](ex *IFiberEx, c *fiber.Ctx, params *T) bool {
+	var zero T
+	ex.docRoute(c, IRouteDoc{Request: zero})
 	if c.Method() == "GET" {
 		if err := c.QueryParser(params); err != nil {
 			if err := ex.ResultError(c, 400, err); err == nil {
@@ -130,7 +168,7 @@ func RequestParser[T comparable](ex *IFiberEx, c *fiber.Ctx, params *T) bool {
 			}
 		}
 	}
-	if err := ex.Validation(*params); len(err) > 0 {
+	if err := ex.LocalizedValidation(c, *params); len(err) > 0 {
 		if err := ex.ResultError(c, 400, fmt.Errorf("validation error: %+v", err), err...); err == nil {
 			return false
 		}
@@ -177,9 +215,18 @@ func ValidatePassword(fl validator.FieldLevel) bool {
 }
 
 func (p *IFiberEx) Validation(src interface{}) []IError {
+	return p.validation(src, *p.Config.DefaultLanguage)
+}
+
+// リクエストの言語でメッセージを返す
+func (p *IFiberEx) LocalizedValidation(c *fiber.Ctx, src interface{}) []IError {
+	return p.validation(src, p.Lang(c))
+}
+
+func (p *IFiberEx) validation(src interface{}, lang string) []IError {
 	err := p.Validator.Struct(src)
 	if err != nil {
-		return p.ValidationParser(src, err.(validator.ValidationErrors))
+		return p.LocalizedValidationParser(src, err.(validator.ValidationErrors), lang)
 	}
 	return nil
 }
@@ -198,13 +245,22 @@ func (p *IFiberEx) SimpleValidation(src interface{}, field string, tag string) [
 }
 
 func (p *IFiberEx) ValidationParser(src interface{}, errors validator.ValidationErrors) []IError {
+	return p.LocalizedValidationParser(src, errors, *p.Config.DefaultLanguage)
+}
+
+func (p *IFiberEx) LocalizedValidationParser(src interface{}, errors validator.ValidationErrors, lang string) []IError {
 	rs := []IError{}
+	trans := p.Translator(lang)
 	for _, err := range errors {
+		message := err.Translate(trans)
+		if message == err.Error() { // 翻訳がないタグ
+			message = fmt.Sprintf("ValidationError.%s", err.Tag())
+		}
 		rs = append(rs, IError{
-			Code:    "E40001",
-			Field:   GetJsonTag(src, err.Field()),
+			Code:    string(E40001),
+			Field:   err.Field(), // jsonタグの名前
 			Param:   err.Param(),
-			Message: fmt.Sprintf("ValidationError.%s", err.Tag()), // TODO: 多言語対応が必要
+			Message: message,
 		})
 	}
 	return rs
@@ -1,8 +1,10 @@
 package fiberextend_test
 
 import (
+	"errors"
 	"testing"
 
+	"github.com/gofiber/fiber/v2"
 	"github.com/h-nosaka/fiberextend"
 	ext "github.com/h-nosaka/fiberextend"
 )
@@ -68,3 +70,41 @@ func TestGetJsonTag(t *testing.T) {
 	}
 	t.Log(rs)
 }
+
+func TestLocalizedValidation(t *testing.T) {
+	test := ext.NewTest(t, ext.IFiberExConfig{})
+	test.Routes(func(ex *ext.IFiberEx) {
+		ex.App.Post("/users", func(c *fiber.Ctx) error {
+			params := StructTest{}
+			if !ext.RequestParser(ex, c, &params) {
+				return nil
+			}
+			return ex.Result(c, 200, params)
+		})
+		ex.App.Get("/unauthorized", func(c *fiber.Ctx) error {
+			return ext.E40101.Wrap(errors.New("unauthorized"))
+		})
+	})
+	body := StructTest{Name: "Qwerty", Email: "hoge@hoge.com", Age: 20, Sex: 1, Password: "Q1w2e3r4t5!!"}
+	test.Run("validation", func() {
+		test.Api("en", &ext.ITestRequest{Method: "POST", Path: "/users", Body: body, Headers: map[string]string{"Accept-Language": "en-US,en;q=0.9"}}, 400, []*ext.ITestCase{
+			{Path: "error.0.field", Want: "name"},
+			{Path: "error.0.message", Want: "name has an invalid format"},
+		}...)
+		test.Api("ja", &ext.ITestRequest{Method: "POST", Path: "/users", Body: body, Headers: map[string]string{"Accept-Language": "ja-JP,ja;q=0.9,en;q=0.8"}}, 400, []*ext.ITestCase{
+			{Path: "error.0.message", Want: "nameの形式が正しくありません"},
+		}...)
+		body.Name = "qwerty"
+		body.Password = "qwerty"
+		test.Api("password", &ext.ITestRequest{Method: "POST", Path: "/users", Body: body, Headers: map[string]string{"Accept-Language": "ja"}}, 400, []*ext.ITestCase{
+			{Path: "error.0.message", Want: "passwordは大文字、小文字、数字、記号を含む12文字以上にしてください"},
+		}...)
+		test.Api("default", &ext.ITestRequest{Method: "POST", Path: "/users", Body: body, Headers: map[string]string{"Accept-Language": "fr"}}, 400, []*ext.ITestCase{
+			{Path: "error.0.message", Want: "password must be at least 12 characters and contain upper and lower case letters, numbers and symbols"},
+		}...)
+	})
+	test.Run("error code", func() {
+		test.Api("ja", &ext.ITestRequest{Method: "GET", Path: "/unauthorized", Headers: map[string]string{"Accept-Language": "ja"}}, 401, &ext.ITestCase{Path: "error.0.message", Want: "認証が必要です"})
+		test.Api("en", &ext.ITestRequest{Method: "GET", Path: "/unauthorized"}, 401, &ext.ITestCase{Path: "error.0.message", Want: "Unauthorized"})
+	})
+}
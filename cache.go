@@ -0,0 +1,159 @@
+package fiberextend
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+type ICache struct {
+	Name        string                      // キャッシュ名 キーのプレフィックスに使用する
+	Expire      time.Duration               // 有効期限
+	Vary        []string                    // キーに含めるリクエストヘッダ
+	Tags        func(c *fiber.Ctx) []string // 無効化に使用するタグ 例: user:42
+	LockTimeout time.Duration               // 再計算中に他のリクエストが待つ時間
+}
+
+type ICacheEntry struct {
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type"`
+	Vary        string `json:"vary,omitempty"`
+	Body        []byte `json:"body"` // msgpack等のバイナリも壊さないようにbase64で保存する
+}
+
+const cacheTagsKey = "cache_tags"
+
+// レスポンスに付けるタグを追加する ハンドラ内で使用する
+func SetCacheTags(c *fiber.Ctx, tags ...string) {
+	if src, ok := c.Locals(cacheTagsKey).([]string); ok {
+		tags = append(src, tags...)
+	}
+	c.Locals(cacheTagsKey, tags)
+}
+
+// メソッド、パス、クエリ、Acceptで選択される形式、指定ヘッダからキーを生成する
+func (p ICache) key(c *fiber.Ctx) string {
+	queries := []string{}
+	for key, value := range c.Queries() {
+		queries = append(queries, fmt.Sprintf("%s=%s", key, value))
+	}
+	sort.Strings(queries)
+	mime, _ := negotiateEncoder(c)
+	src := []string{c.Method(), c.Path(), strings.Join(queries, "&"), mime}
+	for _, name := range p.Vary {
+		src = append(src, fmt.Sprintf("%s=%s", name, c.Get(name)))
+	}
+	hash := sha256.Sum256([]byte(strings.Join(src, "|")))
+	return fmt.Sprintf("cache:%s:%s", p.Name, hex.EncodeToString(hash[:]))
+}
+
+func cacheTagKey(tag string) string {
+	return "cache_tag:" + tag
+}
+
+func (p *IFiberEx) sendCache(c *fiber.Ctx, entry *ICacheEntry) error {
+	c.Set("X-Cache", "HIT")
+	c.Set(fiber.HeaderContentType, entry.ContentType)
+	if len(entry.Vary) > 0 {
+		c.Set(fiber.HeaderVary, entry.Vary)
+	}
+	return c.Status(entry.Status).Send(entry.Body)
+}
+
+// GETのレスポンスをRedisにキャッシュする 再計算は1リクエストのみ行い、他は完了を待つ
+func (p *IFiberEx) Cache(config ICache) func(*fiber.Ctx) error {
+	if len(config.Name) == 0 {
+		config.Name = "default"
+	}
+	if config.LockTimeout == 0 {
+		config.LockTimeout = 5 * time.Second
+	}
+	return func(c *fiber.Ctx) error {
+		if c.Method() != fiber.MethodGet && c.Method() != fiber.MethodHead {
+			return c.Next()
+		}
+		ctx := c.UserContext()
+		key := config.key(c)
+		entry := &ICacheEntry{}
+		if err := p.GetRedisJson(entry, key); err == nil && entry.Status > 0 {
+			return p.sendCache(c, entry)
+		}
+
+		// 再計算のロック
+		token := uuid.NewString()
+		locked, err := p.Redis.SetNX(ctx, "lock:"+key, token, config.LockTimeout).Result()
+		if err != nil {
+			p.LogError(err, p.ApiLogFields(c, zap.String("cache", key))...)
+			return c.Next()
+		}
+		if !locked {
+			// 他のリクエストが再計算中のため完了を待つ
+			deadline := time.Now().Add(config.LockTimeout)
+			for time.Now().Before(deadline) {
+				time.Sleep(50 * time.Millisecond)
+				if err := p.GetRedisJson(entry, key); err == nil && entry.Status > 0 {
+					return p.sendCache(c, entry)
+				}
+			}
+			return c.Next()
+		}
+		defer unlockScript.Run(ctx, p.Redis, []string{"lock:" + key}, token)
+
+		c.Set("X-Cache", "MISS")
+		if err := c.Next(); err != nil {
+			return err
+		}
+		if c.Response().StatusCode() != 200 {
+			return nil
+		}
+		entry = &ICacheEntry{
+			Status:      c.Response().StatusCode(),
+			ContentType: string(c.Response().Header.ContentType()),
+			Vary:        string(c.Response().Header.Peek(fiber.HeaderVary)),
+			Body:        append([]byte(nil), c.Response().Body()...),
+		}
+		if err := p.SetRedisJson(key, entry, config.Expire); err != nil {
+			p.LogError(err, p.ApiLogFields(c, zap.String("cache", key))...)
+			return nil
+		}
+		tags, _ := c.Locals(cacheTagsKey).([]string)
+		if config.Tags != nil {
+			tags = append(tags, config.Tags(c)...)
+		}
+		for _, tag := range tags {
+			pipe := p.Redis.TxPipeline()
+			pipe.SAdd(ctx, cacheTagKey(tag), key)
+			if config.Expire > 0 {
+				pipe.Expire(ctx, cacheTagKey(tag), config.Expire)
+			} else {
+				pipe.Persist(ctx, cacheTagKey(tag)) // 期限のないキャッシュより先にタグが消えないようにする
+			}
+			if _, err := pipe.Exec(ctx); err != nil {
+				p.LogError(err, p.ApiLogFields(c, zap.String("cache", key), zap.String("tag", tag))...)
+			}
+		}
+		return nil
+	}
+}
+
+// タグの付いたキャッシュを全て削除する
+func (p *IFiberEx) InvalidateCache(tags ...string) error {
+	for _, tag := range tags {
+		keys, err := p.Redis.SMembers(background, cacheTagKey(tag)).Result()
+		if err != nil {
+			return err
+		}
+		keys = append(keys, cacheTagKey(tag))
+		if err := p.Redis.Del(background, keys...).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package fiberextend_test
+
+import (
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	ext "github.com/h-nosaka/fiberextend"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestCache(t *testing.T) {
+	test := ext.NewTest(t, ext.IFiberExConfig{
+		UseRedis:     true,
+		RedisOptions: &redis.Options{},
+	})
+	count := 0
+	test.Routes(func(ex *ext.IFiberEx) {
+		ex.App.Get("/users/:id", ex.Cache(ext.ICache{
+			Name:   "users",
+			Expire: time.Minute,
+			Tags: func(c *fiber.Ctx) []string {
+				return []string{"user:" + c.Params("id")}
+			},
+		}), func(c *fiber.Ctx) error {
+			count++
+			return ex.Result(c, 200, map[string]interface{}{"count": count})
+		})
+		// 有効期限なし
+		ex.App.Get("/items/:id", ex.Cache(ext.ICache{Name: "items"}), func(c *fiber.Ctx) error {
+			count++
+			ext.SetCacheTags(c, "item:"+c.Params("id"))
+			return ex.Result(c, 200, map[string]interface{}{"count": count})
+		})
+		ex.App.Get("/slow", ex.Cache(ext.ICache{Name: "slow"}), func(c *fiber.Ctx) error {
+			// ロックの期限切れ後に別のリクエストがロックを取得した状態
+			keys, err := ex.Redis.Keys(c.UserContext(), "lock:cache:slow:*").Result()
+			if err != nil || len(keys) != 1 {
+				return fmt.Errorf("lock: %v, %v", keys, err)
+			}
+			if err := ex.Redis.Set(c.UserContext(), keys[0], "other", 0).Err(); err != nil {
+				return err
+			}
+			return ex.Result(c, 200, map[string]interface{}{"count": 0})
+		})
+	})
+	test.Run("cache", func() {
+		test.Api("miss", &ext.ITestRequest{Method: "GET", Path: "/users/42"}, 200, &ext.ITestCase{Path: "result.count", Want: int64(1)})
+		test.Api("hit", &ext.ITestRequest{Method: "GET", Path: "/users/42"}, 200, &ext.ITestCase{Path: "result.count", Want: int64(1)})
+		var miss []byte
+		for _, want := range []string{"MISS", "HIT"} {
+			req := httptest.NewRequest("GET", "/users/42", nil)
+			req.Header.Set("Accept", ext.MIMEApplicationMsgpack)
+			res, err := test.Ex.App.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want == "MISS" {
+				miss = body
+			} else if string(body) != string(miss) {
+				t.Errorf("cached msgpack body is broken: %x", body)
+			}
+			if res.Header.Get("X-Cache") != want || res.Header.Get("Content-Type") != ext.MIMEApplicationMsgpack || !strings.Contains(res.Header.Get("Vary"), "Accept") {
+				t.Errorf("msgpack: %v", res.Header)
+			}
+		}
+		test.Api("json after msgpack", &ext.ITestRequest{Method: "GET", Path: "/users/42"}, 200, &ext.ITestCase{Path: "result.count", Want: int64(1)})
+		test.Api("other query", &ext.ITestRequest{Method: "GET", Path: "/users/42", Query: &map[string]string{"q": "1"}}, 200, &ext.ITestCase{Path: "result.count", Want: int64(3)})
+		if err := test.Ex.InvalidateCache("user:42"); err != nil {
+			t.Error(err)
+		}
+		test.Api("invalidated", &ext.ITestRequest{Method: "GET", Path: "/users/42"}, 200, &ext.ITestCase{Path: "result.count", Want: int64(4)})
+	})
+	test.Run("no expire", func() {
+		test.Api("miss", &ext.ITestRequest{Method: "GET", Path: "/items/1"}, 200, &ext.ITestCase{Path: "result.count", Want: int64(5)})
+		test.Api("hit", &ext.ITestRequest{Method: "GET", Path: "/items/1"}, 200, &ext.ITestCase{Path: "result.count", Want: int64(5)})
+		if err := test.Ex.InvalidateCache("item:1"); err != nil {
+			t.Error(err)
+		}
+		test.Api("invalidated", &ext.ITestRequest{Method: "GET", Path: "/items/1"}, 200, &ext.ITestCase{Path: "result.count", Want: int64(6)})
+	})
+	test.Run("lock", func() {
+		test.Api("expired lock", &ext.ITestRequest{Method: "GET", Path: "/slow"}, 200)
+		keys := test.Redis.Keys()
+		found := false
+		for _, key := range keys {
+			if strings.HasPrefix(key, "lock:cache:slow:") {
+				if value, _ := test.Redis.Get(key); value == "other" {
+					found = true
+				}
+			}
+		}
+		if !found {
+			t.Errorf("lock of other request was released: %v", keys)
+		}
+	})
+}
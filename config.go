@@ -0,0 +1,283 @@
+package fiberextend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/ettle/strcase"
+	"gopkg.in/yaml.v3"
+)
+
+const configMaxDepth = 4 // 入れ子構造体を辿る深さ
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+type configLoader struct {
+	prefix string
+	file   map[string]interface{}
+}
+
+// 環境変数と設定ファイルから設定を読み込む
+// 環境変数名はprefix + フィールド名のスネークケース 例: APP_DB_CONFIG_ADDR
+// 環境変数名に_FILEを付けた場合はファイルの内容を値として読み込む(Docker/K8sのsecrets)
+// 設定ファイルはyaml/toml/jsonに対応し、キーはフィールド名のスネークケース 例: db_config.addr
+// 同じ項目が両方にある場合は環境変数を優先する
+func LoadConfig(prefix string, files ...string) (IFiberExConfig, error) {
+	config := IFiberExConfig{}
+	loader := &configLoader{prefix: prefix, file: map[string]interface{}{}}
+	for _, file := range files {
+		if err := loader.readFile(file); err != nil {
+			return config, err
+		}
+	}
+	if _, err := loader.load(reflect.ValueOf(&config).Elem(), nil, 0); err != nil {
+		return config, err
+	}
+	if err := config.Validate(); err != nil {
+		return config, err
+	}
+	return config, nil
+}
+
+func (p *configLoader) readFile(file string) error {
+	buf, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	src := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(buf, &src)
+	case ".toml":
+		err = toml.Unmarshal(buf, &src)
+	case ".json":
+		err = json.Unmarshal(buf, &src)
+	default:
+		err = fmt.Errorf("not support config file: %s", file)
+	}
+	if err != nil {
+		return err
+	}
+	for key, value := range src { // 後から読んだファイルで上書きする
+		p.file[key] = value
+	}
+	return nil
+}
+
+// 環境変数、ファイルの順に値を探す
+func (p *configLoader) lookup(path []string) (string, bool, error) {
+	keys := append([]string{}, path...)
+	if len(p.prefix) > 0 {
+		keys = append([]string{p.prefix}, keys...)
+	}
+	name := strings.ToUpper(strings.Join(keys, "_"))
+	if value, ok := os.LookupEnv(name); ok {
+		return value, true, nil
+	}
+	if file, ok := os.LookupEnv(name + "_FILE"); ok {
+		buf, err := os.ReadFile(file)
+		if err != nil {
+			return "", false, fmt.Errorf("%s_FILE: %w", name, err)
+		}
+		return strings.TrimSpace(string(buf)), true, nil
+	}
+	var value interface{} = p.file
+	for _, key := range path {
+		item, ok := value.(map[string]interface{})
+		if !ok {
+			return "", false, nil
+		}
+		if value, ok = item[key]; !ok {
+			return "", false, nil
+		}
+	}
+	switch src := value.(type) {
+	case []interface{}:
+		items := []string{}
+		for _, item := range src {
+			items = append(items, fmt.Sprint(item))
+		}
+		return strings.Join(items, ","), true, nil
+	case map[string]interface{}:
+		items := []string{}
+		for key, item := range src {
+			items = append(items, fmt.Sprintf("%s=%v", key, item))
+		}
+		sort.Strings(items)
+		return strings.Join(items, ","), true, nil
+	}
+	return fmt.Sprint(value), true, nil
+}
+
+// 構造体のフィールドに値を設定する 値が設定された場合はtrueを返す
+func (p *configLoader) load(value reflect.Value, path []string, depth int) (bool, error) {
+	set := false
+	ref := value.Type()
+	for i := 0; i < ref.NumField(); i++ {
+		field := ref.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		key := append(append([]string{}, path...), strcase.ToSnake(field.Name))
+		ok, err := p.loadField(value.Field(i), key, depth)
+		if err != nil {
+			return set, err
+		}
+		set = set || ok
+	}
+	return set, nil
+}
+
+func (p *configLoader) loadField(value reflect.Value, path []string, depth int) (bool, error) {
+	ref := value.Type()
+	switch ref.Kind() {
+	case reflect.Func, reflect.Interface, reflect.Chan:
+		return false, nil
+	case reflect.Ptr:
+		if ref.Elem().Kind() == reflect.Struct {
+			if depth >= configMaxDepth {
+				return false, nil
+			}
+			item := reflect.New(ref.Elem())
+			if !value.IsNil() {
+				item = value
+			}
+			ok, err := p.load(item.Elem(), path, depth+1)
+			if ok && value.IsNil() {
+				value.Set(item)
+			}
+			return ok, err
+		}
+		item := reflect.New(ref.Elem())
+		ok, err := p.loadField(item.Elem(), path, depth)
+		if ok {
+			value.Set(item)
+		}
+		return ok, err
+	case reflect.Struct:
+		if depth >= configMaxDepth {
+			return false, nil
+		}
+		return p.load(value, path, depth+1)
+	}
+	src, ok, err := p.lookup(path)
+	if err != nil || !ok {
+		return false, err
+	}
+	if err := setConfigValue(value, src); err != nil {
+		return false, fmt.Errorf("config %s: %w", strings.Join(path, "."), err)
+	}
+	return true, nil
+}
+
+// 文字列を型に合わせて変換する
+func setConfigValue(value reflect.Value, src string) error {
+	ref := value.Type()
+	if ref == durationType {
+		rs, err := time.ParseDuration(src)
+		if err != nil {
+			return err
+		}
+		value.SetInt(int64(rs))
+		return nil
+	}
+	switch ref.Kind() {
+	case reflect.String:
+		value.SetString(src)
+	case reflect.Bool:
+		rs, err := strconv.ParseBool(src)
+		if err != nil {
+			return err
+		}
+		value.SetBool(rs)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		rs, err := strconv.ParseInt(src, 10, ref.Bits())
+		if err != nil {
+			return err
+		}
+		value.SetInt(rs)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		rs, err := strconv.ParseUint(src, 10, ref.Bits())
+		if err != nil {
+			return err
+		}
+		value.SetUint(rs)
+	case reflect.Float32, reflect.Float64:
+		rs, err := strconv.ParseFloat(src, ref.Bits())
+		if err != nil {
+			return err
+		}
+		value.SetFloat(rs)
+	case reflect.Slice:
+		if ref.Elem().Kind() == reflect.Uint8 { // []byteは文字列として扱う
+			value.SetBytes([]byte(src))
+			return nil
+		}
+		items := strings.Split(src, ",")
+		rs := reflect.MakeSlice(ref, len(items), len(items))
+		for i, item := range items {
+			if err := setConfigValue(rs.Index(i), strings.TrimSpace(item)); err != nil {
+				return err
+			}
+		}
+		value.Set(rs)
+	case reflect.Map:
+		if ref.Key().Kind() != reflect.String {
+			return fmt.Errorf("not support map key: %s", ref.Key())
+		}
+		rs := reflect.MakeMap(ref)
+		for _, item := range strings.Split(src, ",") {
+			kv := strings.SplitN(item, "=", 2)
+			if len(kv) != 2 {
+				return fmt.Errorf("invalid map value: %s", item)
+			}
+			elem := reflect.New(ref.Elem()).Elem()
+			if err := setConfigValue(elem, strings.TrimSpace(kv[1])); err != nil {
+				return err
+			}
+			rs.SetMapIndex(reflect.ValueOf(strings.TrimSpace(kv[0])), elem)
+		}
+		value.Set(rs)
+	default:
+		return fmt.Errorf("not support type: %s", ref)
+	}
+	return nil
+}
+
+// 有効な機能ごとに必須項目を確認する
+func (p *IFiberExConfig) Validate() error {
+	errs := []error{}
+	required := func(ok bool, name string) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("config: %s is required", name))
+		}
+	}
+	if p.UseDB {
+		required(p.DBConfig != nil && len(p.DBConfig.User) > 0, "DBConfig.User")
+		required(p.DBConfig != nil && len(p.DBConfig.DBName) > 0, "DBConfig.DBName")
+	}
+	if p.UseJwt {
+		required(len(p.SecretToken) > 0, "SecretToken")
+	}
+	if len(p.SmtpAddr) > 0 {
+		required(len(p.SmtpFrom) > 0, "SmtpFrom")
+		required(p.SmtpUser != nil, "SmtpUser")
+		required(p.SmtpPass != nil, "SmtpPass")
+	}
+	if p.JobPool > 0 || p.JobProcess > 0 {
+		required(p.UseRedis, "UseRedis")
+	}
+	if p.SentryDsn != nil {
+		required(len(*p.SentryDsn) > 0, "SentryDsn")
+	}
+	return errors.Join(errs...)
+}
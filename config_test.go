@@ -0,0 +1,79 @@
+package fiberextend_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ext "github.com/h-nosaka/fiberextend"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(file, []byte(`
+dev_mode: true
+host: localhost:8080
+use_db: true
+db_config:
+  addr: db:3306
+  user: root
+  db_name: app
+es_config:
+  addresses:
+    - http://es1:9200
+    - http://es2:9200
+secret_token_rotated:
+  old: old-secret
+`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	secret := filepath.Join(dir, "db_pass")
+	if err := os.WriteFile(secret, []byte("qwerty\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("APP_HOST", "example.com")
+	t.Setenv("APP_TOKEN_EXPIRE_AT", "15m")
+	t.Setenv("APP_REDIS_OPTIONS_ADDR", "redis:6380")
+	t.Setenv("APP_DB_CONFIG_PASS_FILE", secret)
+
+	config, err := ext.LoadConfig("APP", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.DevMode == nil || !*config.DevMode {
+		t.Error("dev_mode")
+	}
+	if config.Host != "example.com" {
+		t.Errorf("host: %s", config.Host)
+	}
+	if config.TokenExpireAt != 15*time.Minute {
+		t.Errorf("token_expire_at: %s", config.TokenExpireAt)
+	}
+	if config.DBConfig.Addr != "db:3306" || config.DBConfig.Pass != "qwerty" {
+		t.Errorf("db_config: %+v", config.DBConfig)
+	}
+	if config.RedisOptions == nil || config.RedisOptions.Addr != "redis:6380" {
+		t.Errorf("redis_options: %+v", config.RedisOptions)
+	}
+	if len(config.ESConfig.Addresses) != 2 || config.ESConfig.Addresses[1] != "http://es2:9200" {
+		t.Errorf("es_config: %+v", config.ESConfig.Addresses)
+	}
+	if config.SecretTokenRotated["old"] != "old-secret" {
+		t.Errorf("secret_token_rotated: %+v", config.SecretTokenRotated)
+	}
+	if config.SmtpUser != nil {
+		t.Error("smtp_user must be nil")
+	}
+}
+
+func TestLoadConfigValidation(t *testing.T) {
+	t.Setenv("APP_USE_DB", "true")
+	t.Setenv("APP_USE_JWT", "true")
+	if _, err := ext.LoadConfig("APP"); err == nil {
+		t.Error("missing required fields must be rejected")
+	} else {
+		t.Log(err)
+	}
+}
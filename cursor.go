@@ -0,0 +1,145 @@
+package fiberextend
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type IRequestCursor struct {
+	Cursor *string `json:"cursor,omitempty"` // 前回取得時のカーソル
+	Per    *int    `json:"per,omitempty"`    // 表示数
+}
+
+type ICursor struct {
+	Key  interface{} `json:"k"`           // 最後に取得したソートキー
+	Prev bool        `json:"p,omitempty"` // 前方向の取得
+}
+
+// カーソルを不透明なトークンに変換
+func EncodeCursor(key interface{}, prev bool) (string, error) {
+	buf, err := json.Marshal(&ICursor{Key: key, Prev: prev})
+	if err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(buf), nil
+}
+
+// トークンをカーソルに変換
+func DecodeCursor(src string) (*ICursor, error) {
+	buf, err := base64.URLEncoding.DecodeString(src)
+	if err != nil {
+		return nil, err
+	}
+	rs := &ICursor{}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber() // 大きな整数の精度を落とさない
+	if err := dec.Decode(rs); err != nil {
+		return nil, err
+	}
+	rs.Key = cursorNumber(rs.Key)
+	if keys, ok := rs.Key.([]interface{}); ok {
+		for i, key := range keys {
+			keys[i] = cursorNumber(key)
+		}
+	}
+	return rs, nil
+}
+
+// json.Numberを整数または小数に変換する
+func cursorNumber(src interface{}) interface{} {
+	if num, ok := src.(json.Number); ok {
+		if i, err := num.Int64(); err == nil {
+			return i
+		} else if f, err := num.Float64(); err == nil {
+			return f
+		}
+	}
+	return src
+}
+
+// カーソル情報をlocalsに設定する NewMetaで参照される
+func SetCursor(c *fiber.Ctx, next string, prev string) {
+	c.Locals("cursor_next", next)
+	c.Locals("cursor_prev", prev)
+}
+
+// ソートキーの大小でページングを行い、前後のカーソルをlocalsに設定する
+// columnは一意でソート可能なカラム、keyは取得結果からcolumnの値を返す
+// 一意でないカラムでソートする場合は"created_at,id"のように一意なカラムを続けて指定し、keyは[]interface{}で各カラムの値を返す
+func CursorPaging[T any](ex *IFiberEx, c *fiber.Ctx, query *gorm.DB, params IRequestCursor, column string, key func(T) interface{}) ([]T, error) {
+	rs := []T{}
+	var cur *ICursor
+	if params.Cursor != nil && len(*params.Cursor) > 0 {
+		src, err := DecodeCursor(*params.Cursor)
+		if err != nil {
+			return rs, err
+		}
+		cur = src
+	}
+	per := IRequestPaging{Per: params.Per}.GetPer(*ex.Config.PagePer, *ex.Config.PagePerMax)
+	cols := []clause.Column{}
+	for _, name := range strings.Split(column, ",") {
+		cols = append(cols, clause.Column{Name: strings.TrimSpace(name)})
+	}
+	desc := cur != nil && cur.Prev
+	q := query.Session(&gorm.Session{})
+	if cur != nil && len(cols) == 1 {
+		if cur.Prev {
+			q = q.Where(clause.Lt{Column: cols[0], Value: cur.Key})
+		} else {
+			q = q.Where(clause.Gt{Column: cols[0], Value: cur.Key})
+		}
+	} else if cur != nil {
+		// (created_at, id) > (?, ?) の行値比較 同じ値の行はidの順で続きから取得する
+		keys, ok := cur.Key.([]interface{})
+		if !ok || len(keys) != len(cols) {
+			return rs, fmt.Errorf("invalid cursor key: %v", cur.Key)
+		}
+		op := ">"
+		if cur.Prev {
+			op = "<"
+		}
+		q = q.Where(clause.Expr{SQL: "? " + op + " ?", Vars: []interface{}{cols, keys}})
+	}
+	for _, col := range cols {
+		q = q.Order(clause.OrderByColumn{Column: col, Desc: desc})
+	}
+	if err := q.Limit(per + 1).Find(&rs).Error; err != nil {
+		return rs, err
+	}
+	more := len(rs) > per
+	if more {
+		rs = rs[:per]
+	}
+	if desc { // 前方向は降順で取得しているので並びを戻す
+		for i, j := 0, len(rs)-1; i < j; i, j = i+1, j-1 {
+			rs[i], rs[j] = rs[j], rs[i]
+		}
+	}
+	next, prev := "", ""
+	if len(rs) > 0 {
+		if more || desc {
+			token, err := EncodeCursor(key(rs[len(rs)-1]), false)
+			if err != nil {
+				return rs, err
+			}
+			next = token
+		}
+		if cur != nil && (more || !desc) {
+			token, err := EncodeCursor(key(rs[0]), true)
+			if err != nil {
+				return rs, err
+			}
+			prev = token
+		}
+	}
+	SetCursor(c, next, prev)
+	return rs, nil
+}
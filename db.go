@@ -1,38 +1,27 @@
 package fiberextend
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
 )
 
 func (p *IFiberExConfig) NewDB() *gorm.DB {
-	var db *gorm.DB
-	var err error
-	if p.DBConfig.IsPostgres != nil && *p.DBConfig.IsPostgres {
-		sslmode := "require"
-		if p.DevMode != nil && *p.DevMode {
-			sslmode = "disable"
-		}
-		host := strings.Split(p.DBConfig.Addr, ":")
-		dsn := fmt.Sprintf("user=%s password=%s dbname=%s host=%s port=%s sslmode=%s", p.DBConfig.User, p.DBConfig.Pass, p.DBConfig.DBName, host[0], host[1], sslmode)
-		db, err = gorm.Open(postgres.Open(dsn), p.DBConfig.Config)
-		if err != nil {
-			dsn := fmt.Sprintf("user=%s password=%s host=%s port=%s sslmode=%s", p.DBConfig.User, p.DBConfig.Pass, host[0], host[1], sslmode)
-			db, err = gorm.Open(postgres.Open(dsn), p.DBConfig.Config)
-		}
-	} else {
-		dsn := fmt.Sprintf(
-			"%s:%s@tcp(%s)/%s?charset=utf8mb4&parseTime=True&loc=Local", // mysql dsn
-			p.DBConfig.User,
-			p.DBConfig.Pass,
-			p.DBConfig.Addr,
-			p.DBConfig.DBName,
-		)
-		db, err = gorm.Open(mysql.Open(dsn), p.DBConfig.Config)
+	db, err := p.openDB(p.dsn(p.DBConfig.Addr, true))
+	if err != nil && p.isPostgres() {
+		db, err = p.openDB(p.dsn(p.DBConfig.Addr, false))
+	}
+	if err == nil && len(p.DBConfig.Replicas) > 0 {
+		err = p.useReplicas(db)
 	}
 	if err != nil {
 		if strings.Contains(err.Error(), p.DBConfig.Pass) {
@@ -43,3 +32,171 @@ func (p *IFiberExConfig) NewDB() *gorm.DB {
 	}
 	return db
 }
+
+func (p *IFiberExConfig) isPostgres() bool {
+	return p.DBConfig.IsPostgres != nil && *p.DBConfig.IsPostgres
+}
+
+func (p *IFiberExConfig) driverName() string {
+	if p.isPostgres() {
+		return "pgx"
+	}
+	return "mysql"
+}
+
+// 差し替え可能な接続プールでgormを初期化する
+func (p *IFiberExConfig) openDB(dsn string) (*gorm.DB, error) {
+	pool, err := newConnPool(p.driverName(), dsn, p.DBConfig.configurePool)
+	if err != nil {
+		return nil, err
+	}
+	dialector := mysql.New(mysql.Config{DSN: dsn, Conn: pool})
+	if p.isPostgres() {
+		dialector = postgres.New(postgres.Config{DSN: dsn, Conn: pool})
+	}
+	db, err := gorm.Open(dialector, p.DBConfig.Config)
+	if err != nil {
+		pool.current.Load().Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// 再接続で中身を差し替える接続プール gorm.DBを作り直さないため、実行中のリクエストと競合しない
+type iConnPool struct {
+	driver    string
+	dsn       string
+	configure func(db *sql.DB) // 接続プールの設定 再接続時にも使用する
+	current   atomic.Pointer[sql.DB]
+	mutex     sync.Mutex
+	renewed   time.Time
+}
+
+func newConnPool(driver string, dsn string, configure func(db *sql.DB)) (*iConnPool, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	configure(db)
+	rs := &iConnPool{driver: driver, dsn: dsn, configure: configure, renewed: time.Now()}
+	rs.current.Store(db)
+	return rs, nil
+}
+
+func (p *iConnPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return p.current.Load().PrepareContext(ctx, query)
+}
+
+func (p *iConnPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return p.current.Load().ExecContext(ctx, query, args...)
+}
+
+func (p *iConnPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return p.current.Load().QueryContext(ctx, query, args...)
+}
+
+func (p *iConnPool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return p.current.Load().QueryRowContext(ctx, query, args...)
+}
+
+func (p *iConnPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return p.current.Load().BeginTx(ctx, opts)
+}
+
+func (p *iConnPool) Ping() error {
+	return p.current.Load().Ping()
+}
+
+func (p *iConnPool) GetDBConn() (*sql.DB, error) {
+	return p.current.Load(), nil
+}
+
+// 新しい接続プールに差し替える 元のプールは実行中のクエリとトランザクションが終わってから閉じる
+// interval以内に差し替えていた場合は何もしない(同時に失敗したリクエストからの再接続をまとめる)
+func (p *iConnPool) reconnect(interval time.Duration) (*sql.DB, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if time.Since(p.renewed) < interval {
+		return nil, nil
+	}
+	db, err := sql.Open(p.driver, p.dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	p.configure(db)
+	old := p.current.Load()
+	p.current.Store(db)
+	p.renewed = time.Now()
+	return old, nil
+}
+
+// 接続先ごとのDSN withDBがfalseの場合はDB名を指定しない(postgresのみ)
+func (p *IFiberExConfig) dsn(addr string, withDB bool) string {
+	if p.isPostgres() {
+		sslmode := "require"
+		if p.DevMode != nil && *p.DevMode {
+			sslmode = "disable"
+		}
+		host := strings.Split(addr, ":")
+		if !withDB {
+			return fmt.Sprintf("user=%s password=%s host=%s port=%s sslmode=%s", p.DBConfig.User, p.DBConfig.Pass, host[0], host[1], sslmode)
+		}
+		return fmt.Sprintf("user=%s password=%s dbname=%s host=%s port=%s sslmode=%s", p.DBConfig.User, p.DBConfig.Pass, p.DBConfig.DBName, host[0], host[1], sslmode)
+	}
+	return fmt.Sprintf(
+		"%s:%s@tcp(%s)/%s?charset=utf8mb4&parseTime=True&loc=Local", // mysql dsn
+		p.DBConfig.User,
+		p.DBConfig.Pass,
+		addr,
+		p.DBConfig.DBName,
+	)
+}
+
+// 読み込みをレプリカに振り分ける 書き込みとトランザクションはプライマリを使用する
+// レプリカは起動時に停止していても登録し、疎通確認で復旧したら使用する
+func (p *IFiberExConfig) useReplicas(db *gorm.DB) error {
+	replicas := &iReplicas{
+		primary:  db.Config.ConnPool,
+		logger:   p.DBConfig.Config.Logger,
+		interval: p.DBConfig.ReplicaCheckInterval,
+		timeout:  p.HealthTimeout,
+		stop:     make(chan struct{}),
+	}
+	if replicas.interval <= 0 {
+		replicas.interval = defaultDBConfig.ReplicaCheckInterval
+	}
+	if replicas.timeout <= 0 {
+		replicas.timeout = defaultIFiberExConfig.HealthTimeout
+	}
+	dialectors := []gorm.Dialector{}
+	for _, addr := range p.DBConfig.Replicas {
+		conn, err := sql.Open(p.driverName(), p.dsn(addr, true)) // 接続は最初のクエリまで行わない
+		if err != nil {
+			replicas.close()
+			return err
+		}
+		p.DBConfig.configurePool(conn)
+		item := &iReplica{addr: addr, db: conn}
+		replicas.items = append(replicas.items, item)
+		if p.isPostgres() {
+			dialectors = append(dialectors, postgres.New(postgres.Config{Conn: item}))
+		} else {
+			dialectors = append(dialectors, mysql.New(mysql.Config{Conn: item, SkipInitializeWithVersion: true}))
+		}
+	}
+	if err := db.Use(dbresolver.Register(dbresolver.Config{Replicas: dialectors, Policy: replicas})); err != nil {
+		replicas.close()
+		return err
+	}
+	if err := db.Use(replicas); err != nil {
+		replicas.close()
+		return err
+	}
+	replicas.check()
+	go replicas.monitor()
+	return nil
+}
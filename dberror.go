@@ -0,0 +1,152 @@
+package fiberextend
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// DBエラーの分類 DBErrorNone以外は再実行で成功する可能性がある
+type DBErrorKind int
+
+const (
+	DBErrorNone          DBErrorKind = iota
+	DBErrorConnection                // 接続断 接続プールが再接続する
+	DBErrorDeadlock                  // デッドロック、ロック待ちタイムアウト
+	DBErrorSerialization             // 直列化の失敗
+	DBErrorCachedPlan                // prepared statementのキャッシュ不整合 再接続が必要
+)
+
+func (p DBErrorKind) String() string {
+	switch p {
+	case DBErrorConnection:
+		return "connection"
+	case DBErrorDeadlock:
+		return "deadlock"
+	case DBErrorSerialization:
+		return "serialization"
+	case DBErrorCachedPlan:
+		return "cached_plan"
+	}
+	return "none"
+}
+
+// MySQLのエラー番号
+var mysqlErrorKinds = map[uint16]DBErrorKind{
+	1053: DBErrorConnection, // ER_SERVER_SHUTDOWN
+	1205: DBErrorDeadlock,   // ER_LOCK_WAIT_TIMEOUT
+	1213: DBErrorDeadlock,   // ER_LOCK_DEADLOCK
+	2006: DBErrorConnection, // CR_SERVER_GONE_ERROR
+	2013: DBErrorConnection, // CR_SERVER_LOST
+}
+
+// PostgreSQLのSQLSTATE
+var postgresErrorKinds = map[string]DBErrorKind{
+	"40001": DBErrorSerialization, // serialization_failure
+	"40P01": DBErrorDeadlock,      // deadlock_detected
+	"55P03": DBErrorDeadlock,      // lock_not_available
+	"57P01": DBErrorConnection,    // admin_shutdown
+	"57P02": DBErrorConnection,    // crash_shutdown
+	"57P03": DBErrorConnection,    // cannot_connect_now
+}
+
+// ドライバのエラーから再実行できるかを判定する
+func ClassifyDBError(err error) DBErrorKind {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return DBErrorNone // リクエストの中断はnet.Errorとして扱わない
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErrorKinds[mysqlErr.Number]
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		if pgErr.Code == "0A000" && strings.Contains(pgErr.Message, "cached plan must not change result type") {
+			return DBErrorCachedPlan
+		}
+		if strings.HasPrefix(pgErr.Code, "08") { // connection_exception
+			return DBErrorConnection
+		}
+		return postgresErrorKinds[pgErr.Code]
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) || errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) ||
+		pgconn.SafeToRetry(err) {
+		return DBErrorConnection
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return DBErrorConnection
+	}
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "cached plan must not change result type"):
+		return DBErrorCachedPlan
+	case strings.Contains(msg, "server has gone away"), strings.Contains(msg, "sql: database is closed"):
+		return DBErrorConnection
+	}
+	return DBErrorNone
+}
+
+// 再実行で成功する可能性があるエラー
+func IsTransientDBError(err error) bool {
+	return ClassifyDBError(err) != DBErrorNone
+}
+
+type IRetry struct {
+	Attempts   int           // 最大試行回数 既定は3
+	Backoff    time.Duration // 初回の待ち時間 試行ごとに倍にする 既定は100ms
+	MaxBackoff time.Duration // 待ち時間の上限 既定は2s
+}
+
+// 一時的なエラーの場合にfnを再実行する 冪等な処理かトランザクション全体に使用すること
+// キャッシュ不整合の場合は再接続してから再実行する
+func (p *IFiberEx) RetryDB(ctx context.Context, config IRetry, fn func(db *gorm.DB) error) error {
+	if config.Attempts <= 0 {
+		config.Attempts = 3
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = 100 * time.Millisecond
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = 2 * time.Second
+	}
+	backoff := config.Backoff
+	var err error
+	for i := 1; ; i++ {
+		if err = fn(p.DB.WithContext(ctx)); err == nil {
+			return nil
+		}
+		kind := ClassifyDBError(err)
+		if kind == DBErrorNone || i >= config.Attempts {
+			return err
+		}
+		// LogWarnはSentryへの送信と再接続を伴うため使用しない 再接続はここでのみ行う
+		p.Log.With(p.LogCaller()).Warn(err.Error(), zap.String("retry", kind.String()), zap.Int("attempt", i))
+		if kind == DBErrorCachedPlan {
+			p.ReconnectDB()
+		}
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1)) // 同時に失敗したリクエストが重ならないようにずらす
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		if backoff *= 2; backoff > config.MaxBackoff {
+			backoff = config.MaxBackoff
+		}
+	}
+}
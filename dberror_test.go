@@ -0,0 +1,113 @@
+package fiberextend_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	ext "github.com/h-nosaka/fiberextend"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"gorm.io/gorm"
+)
+
+func TestClassifyDBError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want ext.DBErrorKind
+	}{
+		{nil, ext.DBErrorNone},
+		{errors.New("syntax error"), ext.DBErrorNone},
+		{gorm.ErrRecordNotFound, ext.DBErrorNone},
+		{context.DeadlineExceeded, ext.DBErrorNone},
+		{&mysql.MySQLError{Number: 1213, Message: "Deadlock found"}, ext.DBErrorDeadlock},
+		{&mysql.MySQLError{Number: 2006, Message: "MySQL server has gone away"}, ext.DBErrorConnection},
+		{&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}, ext.DBErrorNone},
+		{mysql.ErrInvalidConn, ext.DBErrorConnection},
+		{fmt.Errorf("query: %w", &pgconn.PgError{Code: "40001"}), ext.DBErrorSerialization},
+		{&pgconn.PgError{Code: "40P01"}, ext.DBErrorDeadlock},
+		{&pgconn.PgError{Code: "08006"}, ext.DBErrorConnection},
+		{&pgconn.PgError{Code: "0A000", Message: "cached plan must not change result type"}, ext.DBErrorCachedPlan},
+		{&pgconn.PgError{Code: "23505"}, ext.DBErrorNone},
+		{errors.New("ERROR: cached plan must not change result type (SQLSTATE 0A000)"), ext.DBErrorCachedPlan},
+		{driver.ErrBadConn, ext.DBErrorConnection},
+		{fmt.Errorf("read: %w", syscall.ECONNRESET), ext.DBErrorConnection},
+	}
+	for _, tt := range tests {
+		if rs := ext.ClassifyDBError(tt.err); rs != tt.want {
+			t.Errorf("%v: got %s, want %s", tt.err, rs, tt.want)
+		}
+	}
+}
+
+func TestRetryDB(t *testing.T) {
+	ex := ext.New(ext.IFiberExConfig{DevMode: ext.Bool(true), TestMode: ext.Bool(true)})
+	db, err := gorm.Open(txDialector{conn: &txConn{recorder: &txRecorder{}}}, &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ex.DB = db
+	config := ext.IRetry{Attempts: 3, Backoff: time.Millisecond}
+
+	count := 0
+	err = ex.RetryDB(context.Background(), config, func(db *gorm.DB) error {
+		if count++; count < 3 {
+			return &mysql.MySQLError{Number: 1213}
+		}
+		return nil
+	})
+	if err != nil || count != 3 {
+		t.Errorf("deadlock: %v, %d", err, count)
+	}
+
+	count = 0
+	err = ex.RetryDB(context.Background(), config, func(db *gorm.DB) error {
+		count++
+		return driver.ErrBadConn
+	})
+	if !errors.Is(err, driver.ErrBadConn) || count != 3 {
+		t.Errorf("attempts: %v, %d", err, count)
+	}
+
+	count = 0
+	err = ex.RetryDB(context.Background(), config, func(db *gorm.DB) error {
+		count++
+		return gorm.ErrRecordNotFound
+	})
+	if !errors.Is(err, gorm.ErrRecordNotFound) || count != 1 {
+		t.Errorf("permanent: %v, %d", err, count)
+	}
+}
+
+func TestRetryDBReconnect(t *testing.T) {
+	ex := ext.New(ext.IFiberExConfig{DevMode: ext.Bool(true), TestMode: ext.Bool(true)})
+	db, err := gorm.Open(txDialector{conn: &txConn{recorder: &txRecorder{}}}, &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ex.DB = db
+	core, logs := observer.New(zap.DebugLevel)
+	ex.Log = zap.New(core)
+
+	// 差し替えできない接続プールのため、再接続の試行ごとにエラーが1件記録される
+	count := 0
+	err = ex.RetryDB(context.Background(), ext.IRetry{Attempts: 3, Backoff: time.Millisecond}, func(db *gorm.DB) error {
+		count++
+		return &pgconn.PgError{Code: "0A000", Message: "cached plan must not change result type"}
+	})
+	if err == nil || count != 3 {
+		t.Errorf("cached plan: %v, %d", err, count)
+	}
+	if rs := logs.FilterMessage("DBの接続プールが差し替えできないため再接続しない").Len(); rs != 2 {
+		t.Errorf("reconnect must run once per retry: %d", rs)
+	}
+	if rs := logs.FilterLevelExact(zap.WarnLevel).FilterField(zap.String("retry", "cached_plan")).Len(); rs != 2 {
+		t.Errorf("retry must be logged as warn: %d", rs)
+	}
+}
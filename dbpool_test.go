@@ -0,0 +1,58 @@
+package fiberextend
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestConfigurePool(t *testing.T) {
+	config := &IDBConfig{MaxOpenConns: Int(5), MaxIdleConns: Int(2), ConnMaxLifetime: time.Hour, ConnMaxIdleTime: time.Minute}
+	db := sql.OpenDB(&replicaPool{})
+	defer db.Close()
+	config.configurePool(db)
+	if rs := db.Stats().MaxOpenConnections; rs != 5 {
+		t.Errorf("max open: %d", rs)
+	}
+	// 3本使用して返すとMaxIdleConnsを超えた1本は閉じられる
+	ctx := context.Background()
+	conns := []*sql.Conn{}
+	for i := 0; i < 3; i++ {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns = append(conns, conn)
+	}
+	for _, conn := range conns {
+		conn.Close()
+	}
+	if rs := db.Stats(); rs.Idle != 2 || rs.MaxIdleClosed != 1 {
+		t.Errorf("idle: %d, max idle closed: %d", rs.Idle, rs.MaxIdleClosed)
+	}
+
+	// 未指定の項目はdatabase/sqlの既定値のまま
+	db = sql.OpenDB(&replicaPool{})
+	defer db.Close()
+	(&IDBConfig{}).configurePool(db)
+	if rs := db.Stats().MaxOpenConnections; rs != 0 {
+		t.Errorf("max open: %d", rs)
+	}
+}
+
+func TestNewPoolConfig(t *testing.T) {
+	newEx := func(config *IDBConfig) *IFiberEx {
+		config.IsPostgres, config.Addr = Bool(true), "127.0.0.1:1" // 接続は最初のクエリまで行わない
+		config.Config = &gorm.Config{DisableAutomaticPing: true}
+		return New(IFiberExConfig{TestMode: Bool(true), UseDB: true, DBConfig: config})
+	}
+	if rs := newEx(&IDBConfig{}).DBStats(); len(rs) != 1 || rs[0].MaxOpen != *defaultDBConfig.MaxOpenConns {
+		t.Errorf("default: %+v", rs)
+	}
+	if rs := newEx(&IDBConfig{MaxOpenConns: Int(7)}).DBStats(); len(rs) != 1 || rs[0].MaxOpen != 7 {
+		t.Errorf("config: %+v", rs)
+	}
+}
@@ -0,0 +1,130 @@
+package fiberextend
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// 接続プールの状態 PoolはprimaryまたはレプリカのAddr
+type IDBStats struct {
+	Pool              string        `json:"pool"`
+	MaxOpen           int           `json:"max_open"`
+	Open              int           `json:"open"`
+	InUse             int           `json:"in_use"`
+	Idle              int           `json:"idle"`
+	WaitCount         int64         `json:"wait_count"`    // 接続の空きを待った回数
+	WaitDuration      time.Duration `json:"wait_duration"` // 接続の空きを待った合計時間
+	MaxIdleClosed     int64         `json:"max_idle_closed"`
+	MaxIdleTimeClosed int64         `json:"max_idle_time_closed"`
+	MaxLifetimeClosed int64         `json:"max_lifetime_closed"`
+}
+
+func newDBStats(pool string, db *sql.DB) IDBStats {
+	stats := db.Stats()
+	return IDBStats{
+		Pool:              pool,
+		MaxOpen:           stats.MaxOpenConnections,
+		Open:              stats.OpenConnections,
+		InUse:             stats.InUse,
+		Idle:              stats.Idle,
+		WaitCount:         stats.WaitCount,
+		WaitDuration:      stats.WaitDuration,
+		MaxIdleClosed:     stats.MaxIdleClosed,
+		MaxIdleTimeClosed: stats.MaxIdleTimeClosed,
+		MaxLifetimeClosed: stats.MaxLifetimeClosed,
+	}
+}
+
+// IDBConfigの接続プールの設定を反映する
+func (p *IDBConfig) configurePool(db *sql.DB) {
+	if p.MaxOpenConns != nil {
+		db.SetMaxOpenConns(*p.MaxOpenConns)
+	}
+	if p.MaxIdleConns != nil {
+		db.SetMaxIdleConns(*p.MaxIdleConns)
+	}
+	if p.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(p.ConnMaxLifetime)
+	}
+	if p.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(p.ConnMaxIdleTime)
+	}
+}
+
+// プライマリとレプリカの接続プールの状態
+func (p *IFiberEx) DBStats() []IDBStats {
+	rs := []IDBStats{}
+	if p.DB == nil {
+		return rs
+	}
+	if db, err := p.DB.DB(); err == nil {
+		rs = append(rs, newDBStats("primary", db))
+	}
+	if plugin, ok := p.DB.Config.Plugins[replicasPluginName]; ok {
+		for _, item := range plugin.(*iReplicas).items {
+			rs = append(rs, newDBStats(item.addr, item.db))
+		}
+	}
+	return rs
+}
+
+// 接続プールの状態を定期的にログに出力する シャットダウンで停止する
+func (p *IFiberEx) logDBStats(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if p.IsShuttingDown() {
+			return
+		}
+		for _, stats := range p.DBStats() {
+			p.LogInfo("db pool",
+				zap.String("pool", stats.Pool),
+				zap.Int("max_open", stats.MaxOpen),
+				zap.Int("open", stats.Open),
+				zap.Int("in_use", stats.InUse),
+				zap.Int("idle", stats.Idle),
+				zap.Int64("wait_count", stats.WaitCount),
+				zap.Duration("wait_duration", stats.WaitDuration),
+			)
+		}
+	}
+}
+
+// Prometheusの形式で出力する項目
+var dbMetrics = []struct {
+	name  string
+	kind  string
+	help  string
+	value func(stats IDBStats) float64
+}{
+	{"db_pool_max_open_connections", "gauge", "Maximum number of open connections.", func(s IDBStats) float64 { return float64(s.MaxOpen) }},
+	{"db_pool_open_connections", "gauge", "Number of established connections.", func(s IDBStats) float64 { return float64(s.Open) }},
+	{"db_pool_in_use_connections", "gauge", "Number of connections currently in use.", func(s IDBStats) float64 { return float64(s.InUse) }},
+	{"db_pool_idle_connections", "gauge", "Number of idle connections.", func(s IDBStats) float64 { return float64(s.Idle) }},
+	{"db_pool_wait_count_total", "counter", "Total number of connections waited for.", func(s IDBStats) float64 { return float64(s.WaitCount) }},
+	{"db_pool_wait_duration_seconds_total", "counter", "Total time blocked waiting for a new connection.", func(s IDBStats) float64 { return s.WaitDuration.Seconds() }},
+	{"db_pool_max_idle_closed_total", "counter", "Total number of connections closed due to SetMaxIdleConns.", func(s IDBStats) float64 { return float64(s.MaxIdleClosed) }},
+	{"db_pool_max_idle_time_closed_total", "counter", "Total number of connections closed due to SetConnMaxIdleTime.", func(s IDBStats) float64 { return float64(s.MaxIdleTimeClosed) }},
+	{"db_pool_max_lifetime_closed_total", "counter", "Total number of connections closed due to SetConnMaxLifetime.", func(s IDBStats) float64 { return float64(s.MaxLifetimeClosed) }},
+}
+
+// 接続プールの状態をPrometheusのテキスト形式で返す
+func (p *IFiberEx) MetricsHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		stats := p.DBStats()
+		var buf strings.Builder
+		for _, metric := range dbMetrics {
+			fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s %s\n", metric.name, metric.help, metric.name, metric.kind)
+			for _, item := range stats {
+				fmt.Fprintf(&buf, "%s{pool=%q} %v\n", metric.name, item.Pool, metric.value(item))
+			}
+		}
+		c.Set(fiber.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+		return c.SendString(buf.String())
+	}
+}
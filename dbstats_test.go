@@ -0,0 +1,57 @@
+package fiberextend_test
+
+import (
+	"database/sql"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	ext "github.com/h-nosaka/fiberextend"
+	gmysql "gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestMetrics(t *testing.T) {
+	test := ext.NewTest(t, ext.IFiberExConfig{UseMetrics: true})
+	test.Routes(func(ex *ext.IFiberEx) {
+		conn, err := sql.Open("mysql", "user:pass@tcp(127.0.0.1:1)/app") // 接続はしない
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetMaxOpenConns(5)
+		ex.DB, err = gorm.Open(gmysql.New(gmysql.Config{Conn: conn, SkipInitializeWithVersion: true}), &gorm.Config{DisableAutomaticPing: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	test.Run("stats", func() {
+		stats := test.Ex.DBStats()
+		if len(stats) != 1 || stats[0].Pool != "primary" || stats[0].MaxOpen != 5 {
+			t.Errorf("stats: %+v", stats)
+		}
+	})
+	test.Run("metrics", func() {
+		res, err := test.Ex.App.Test(httptest.NewRequest("GET", "/metrics", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != 200 || !strings.HasPrefix(res.Header.Get("Content-Type"), "text/plain") {
+			t.Errorf("status: %d, content-type: %s", res.StatusCode, res.Header.Get("Content-Type"))
+		}
+		for _, want := range []string{
+			"# TYPE db_pool_in_use_connections gauge\n",
+			`db_pool_max_open_connections{pool="primary"} 5` + "\n",
+			`db_pool_wait_count_total{pool="primary"} 0` + "\n",
+		} {
+			if !strings.Contains(string(body), want) {
+				t.Errorf("missing %q in\n%s", want, body)
+			}
+		}
+	})
+}
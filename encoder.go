@@ -0,0 +1,200 @@
+package fiberextend
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	MIMEApplicationMsgpack = "application/msgpack"
+	MIMETextCSV            = "text/csv"
+	MIMEApplicationNDJSON  = "application/x-ndjson"
+)
+
+// IResponseを指定の形式に変換する
+type IEncoder func(body *IResponse) ([]byte, error)
+
+var encoderMutex sync.RWMutex
+var encoderTypes = []string{}
+var encoders = map[string]IEncoder{}
+
+func init() {
+	RegisterEncoder(fiber.MIMEApplicationJSON, EncodeJson)
+	RegisterEncoder(MIMEApplicationMsgpack, EncodeMsgpack)
+	RegisterEncoder(MIMETextCSV, EncodeCSV)
+	RegisterEncoder(MIMEApplicationNDJSON, EncodeNDJSON)
+}
+
+// Acceptで選択できる形式を登録する 同じ形式は上書きする 先に登録した形式を優先する
+func RegisterEncoder(mime string, encoder IEncoder) {
+	encoderMutex.Lock()
+	defer encoderMutex.Unlock()
+	if _, ok := encoders[mime]; !ok {
+		encoderTypes = append(encoderTypes, mime)
+	}
+	encoders[mime] = encoder
+}
+
+// Acceptから形式を選ぶ 該当がない場合はjson
+func negotiateEncoder(c *fiber.Ctx) (string, IEncoder) {
+	encoderMutex.RLock()
+	defer encoderMutex.RUnlock()
+	if mime := c.Accepts(encoderTypes...); len(mime) > 0 {
+		return mime, encoders[mime]
+	}
+	return fiber.MIMEApplicationJSON, encoders[fiber.MIMEApplicationJSON]
+}
+
+func EncodeJson(body *IResponse) ([]byte, error) {
+	return json.Marshal(body)
+}
+
+// jsonタグのフィールド名で出力する
+func EncodeMsgpack(body *IResponse) ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	enc := msgpack.NewEncoder(buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(body); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// 1行に1件のjsonを出力し、最終行にmetaとerrorを出力する
+func EncodeNDJSON(body *IResponse) ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	enc := json.NewEncoder(buf)
+	for _, item := range responseItems(body) {
+		if err := enc.Encode(item); err != nil {
+			return nil, err
+		}
+	}
+	if err := enc.Encode(&IResponse{Meta: body.Meta, Errors: body.Errors}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// 1行に1件を出力する 列は構造体のcsvタグ、なければjsonタグで決める
+func EncodeCSV(body *IResponse) ([]byte, error) {
+	items := responseItems(body)
+	if len(body.Errors) > 0 {
+		items = []interface{}{}
+		for _, item := range body.Errors {
+			items = append(items, item)
+		}
+	}
+	buf := bytes.NewBuffer(nil)
+	w := csv.NewWriter(buf)
+	var columns []string
+	for _, item := range items {
+		header, row := csvRow(item)
+		if columns == nil {
+			columns = header
+			if err := w.Write(columns); err != nil {
+				return nil, err
+			}
+		}
+		if err := w.Write(row); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// ResultまたはResultsを一覧で取得
+func responseItems(body *IResponse) []interface{} {
+	if body.Results != nil {
+		return body.Results
+	}
+	if body.Result == nil {
+		return []interface{}{}
+	}
+	ref := reflect.ValueOf(body.Result)
+	if ref.Kind() == reflect.Slice || ref.Kind() == reflect.Array {
+		items := []interface{}{}
+		for i := 0; i < ref.Len(); i++ {
+			items = append(items, ref.Index(i).Interface())
+		}
+		return items
+	}
+	return []interface{}{body.Result}
+}
+
+// 1件をヘッダと値に変換する
+func csvRow(src interface{}) ([]string, []string) {
+	ref := reflect.ValueOf(src)
+	for ref.Kind() == reflect.Ptr || ref.Kind() == reflect.Interface {
+		if ref.IsNil() {
+			return []string{}, []string{}
+		}
+		ref = ref.Elem()
+	}
+	header, row := []string{}, []string{}
+	switch ref.Kind() {
+	case reflect.Struct:
+		for i := 0; i < ref.NumField(); i++ {
+			field := ref.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name := csvColumnName(field)
+			if name == "-" {
+				continue
+			}
+			header = append(header, name)
+			row = append(row, csvValue(ref.Field(i)))
+		}
+	case reflect.Map:
+		keys := []string{}
+		for _, key := range ref.MapKeys() {
+			keys = append(keys, fmt.Sprint(key.Interface()))
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			header = append(header, key)
+			row = append(row, csvValue(ref.MapIndex(reflect.ValueOf(key).Convert(ref.Type().Key()))))
+		}
+	default:
+		header = append(header, "value")
+		row = append(row, csvValue(ref))
+	}
+	return header, row
+}
+
+func csvColumnName(field reflect.StructField) string {
+	for _, tag := range []string{"csv", "json"} {
+		if name := strings.SplitN(field.Tag.Get(tag), ",", 2)[0]; len(name) > 0 {
+			return name
+		}
+	}
+	return field.Name
+}
+
+// 値を文字列に変換する 構造体や配列はjsonにする
+func csvValue(ref reflect.Value) string {
+	for ref.Kind() == reflect.Ptr || ref.Kind() == reflect.Interface {
+		if ref.IsNil() {
+			return ""
+		}
+		ref = ref.Elem()
+	}
+	if s, ok := ref.Interface().(fmt.Stringer); ok {
+		return s.String()
+	}
+	switch ref.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+		return ToJson(ref.Interface())
+	}
+	return fmt.Sprint(ref.Interface())
+}
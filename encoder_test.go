@@ -0,0 +1,103 @@
+package fiberextend_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	ext "github.com/h-nosaka/fiberextend"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+type encoderItem struct {
+	Id     int    `json:"id"`
+	Name   string `json:"name" csv:"item_name"`
+	Secret string `json:"-"`
+}
+
+func TestEncoder(t *testing.T) {
+	test := ext.NewTest(t, ext.IFiberExConfig{})
+	items := []encoderItem{{Id: 1, Name: "foo", Secret: "x"}, {Id: 2, Name: "bar, baz", Secret: "y"}}
+	test.Routes(func(ex *ext.IFiberEx) {
+		ex.App.Get("/items", func(c *fiber.Ctx) error {
+			return ex.Result(c, 200, items)
+		})
+	})
+	get := func(accept string) (string, string) {
+		req := httptest.NewRequest("GET", "/items", nil)
+		if len(accept) > 0 {
+			req.Header.Set(fiber.HeaderAccept, accept)
+		}
+		res, err := test.Ex.App.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(res.Header.Get(fiber.HeaderVary), fiber.HeaderAccept) {
+			t.Errorf("vary: %s", res.Header.Get(fiber.HeaderVary))
+		}
+		return res.Header.Get(fiber.HeaderContentType), string(body)
+	}
+	test.Run("json", func() {
+		for _, accept := range []string{"", "*/*", "application/json", "application/xml"} {
+			mime, body := get(accept)
+			if mime != "application/json; charset=utf-8" {
+				t.Errorf("%s: content-type: %s", accept, mime)
+			}
+			rs := map[string]interface{}{}
+			if err := json.Unmarshal([]byte(body), &rs); err != nil {
+				t.Errorf("%s: %v", accept, err)
+			}
+		}
+	})
+	test.Run("csv", func() {
+		mime, body := get("text/csv")
+		if mime != "text/csv; charset=utf-8" {
+			t.Errorf("content-type: %s", mime)
+		}
+		want := "id,item_name\n1,foo\n2,\"bar, baz\"\n"
+		if body != want {
+			t.Errorf("body: %q want %q", body, want)
+		}
+	})
+	test.Run("ndjson", func() {
+		mime, body := get("application/x-ndjson")
+		if mime != "application/x-ndjson; charset=utf-8" {
+			t.Errorf("content-type: %s", mime)
+		}
+		lines := strings.Split(strings.TrimSpace(body), "\n")
+		if len(lines) != 3 {
+			t.Fatalf("lines: %d", len(lines))
+		}
+		if lines[0] != `{"id":1,"name":"foo"}` {
+			t.Errorf("line: %s", lines[0])
+		}
+		if !strings.HasPrefix(lines[2], `{"meta":`) {
+			t.Errorf("meta: %s", lines[2])
+		}
+	})
+	test.Run("msgpack", func() {
+		mime, body := get("application/msgpack, application/json;q=0.5")
+		if mime != ext.MIMEApplicationMsgpack {
+			t.Errorf("content-type: %s", mime)
+		}
+		rs := map[string]interface{}{}
+		if err := msgpack.Unmarshal([]byte(body), &rs); err != nil {
+			t.Fatal(err)
+		}
+		results, ok := rs["result"].([]interface{})
+		if !ok || len(results) != 2 {
+			t.Fatalf("result: %v", rs["result"])
+		}
+		if name := results[1].(map[string]interface{})["name"]; name != "bar, baz" {
+			t.Errorf("name: %v", name)
+		}
+	})
+}
@@ -1,27 +1,197 @@
 package fiberextend
 
 import (
+	"bytes"
 	"fmt"
 	"runtime"
+	"sort"
 	"strings"
+	"sync"
+	"text/template"
 )
 
-type ErrorCode int
+type ErrorCode string
 
 const (
-	E00500 ErrorCode = iota
-	E40001
-	E99999
+	E00500 ErrorCode = "E00500"
+	E40001 ErrorCode = "E40001"
+	E99999 ErrorCode = "E99999"
+	E40101 ErrorCode = "E40101"
+	E42901 ErrorCode = "E42901"
+	E40901 ErrorCode = "E40901"
+	E42201 ErrorCode = "E42201"
+	E41201 ErrorCode = "E41201"
 )
 
+type IErrorDefinition struct {
+	Code        ErrorCode         `json:"code"`
+	Status      int               `json:"status"`             // HTTPステータス
+	Message     string            `json:"message"`            // メッセージ text/template形式 例: {{.id}} is not found
+	Messages    map[string]string `json:"messages,omitempty"` // 言語ごとのメッセージ
+	Description string            `json:"description"`        // API利用者向けの説明
+	template    *template.Template
+	templates   map[string]*template.Template
+}
+
+var errorRegistry = sync.Map{}
+
+func init() {
+	RegisterErrorCode(E00500, 500, "Internal Server Error", "サーバ内部でエラーが発生しました")
+	RegisterErrorCode(E40001, 400, "Validation Error", "リクエストパラメータが不正です")
+	RegisterErrorCode(E40101, 401, "Unauthorized", "認証トークンがない、または不正です")
+	RegisterErrorCode(E40901, 409, "Request In Progress", "同じIdempotency-Keyのリクエストが処理中です")
+	RegisterErrorCode(E41201, 412, "Precondition Failed", "If-Matchのリソースが更新されています")
+	RegisterErrorCode(E42201, 422, "Idempotency Key Mismatch", "同じIdempotency-Keyで異なるリクエストが送信されました")
+	RegisterErrorCode(E42901, 429, "Too Many Requests", "リクエスト数が上限を超えました")
+	RegisterErrorCode(E99999, 500, "Undefined Error", "未定義のエラーです")
+	RegisterErrorMessage(E00500, "ja", "サーバエラーが発生しました")
+	RegisterErrorMessage(E40001, "ja", "入力内容に誤りがあります")
+	RegisterErrorMessage(E40101, "ja", "認証が必要です")
+	RegisterErrorMessage(E40901, "ja", "同じリクエストを処理中です")
+	RegisterErrorMessage(E41201, "ja", "データが更新されています")
+	RegisterErrorMessage(E42201, "ja", "リクエスト内容が異なります")
+	RegisterErrorMessage(E42901, "ja", "リクエスト数が上限を超えました")
+	RegisterErrorMessage(E99999, "ja", "不明なエラーが発生しました")
+}
+
+// エラーコードを登録する 同じコードは上書きする
+func RegisterErrorCode(code ErrorCode, status int, message string, description string) ErrorCode {
+	errorRegistry.Store(code, &IErrorDefinition{
+		Code:        code,
+		Status:      status,
+		Message:     message,
+		Messages:    map[string]string{},
+		Description: description,
+		template:    newErrorTemplate(code, message),
+		templates:   map[string]*template.Template{},
+	})
+	return code
+}
+
+// 言語ごとのメッセージを登録する RegisterErrorCodeの後に呼ぶ
+func RegisterErrorMessage(code ErrorCode, lang string, message string) {
+	src, ok := errorRegistry.Load(code)
+	if !ok {
+		panic(fmt.Errorf("error code is not registered: %s", code))
+	}
+	def := *src.(*IErrorDefinition) // 参照中の定義は変更しない
+	def.Messages = map[string]string{lang: message}
+	def.templates = map[string]*template.Template{lang: newErrorTemplate(code, message)}
+	for key, value := range src.(*IErrorDefinition).Messages {
+		if key != lang {
+			def.Messages[key] = value
+			def.templates[key] = src.(*IErrorDefinition).templates[key]
+		}
+	}
+	errorRegistry.Store(code, &def)
+}
+
+func newErrorTemplate(code ErrorCode, message string) *template.Template {
+	return template.Must(template.New(string(code)).Option("missingkey=zero").Parse(message))
+}
+
+// 登録内容を取得 未登録の場合はE99999
+func (p ErrorCode) Definition() *IErrorDefinition {
+	if def, ok := errorRegistry.Load(p); ok {
+		return def.(*IErrorDefinition)
+	}
+	def, _ := errorRegistry.Load(E99999)
+	return def.(*IErrorDefinition)
+}
+
+func (p ErrorCode) Status() int {
+	return p.Definition().Status
+}
+
+// パラメータを埋め込んだメッセージ
+func (p ErrorCode) Message(params map[string]interface{}) string {
+	return p.LocalizedMessage("", params)
+}
+
+// 指定言語のメッセージ 登録がない場合は既定のメッセージ
+func (p ErrorCode) LocalizedMessage(lang string, params map[string]interface{}) string {
+	def := p.Definition()
+	tmpl, ok := def.templates[lang]
+	if !ok {
+		tmpl = def.template
+	}
+	buf := bytes.NewBufferString("")
+	if err := tmpl.Execute(buf, params); err != nil {
+		return def.Message
+	}
+	return buf.String()
+}
+
 func (p ErrorCode) Errors() []IError {
-	switch p {
-	case E40001:
-		return []IError{{Code: "E40001", Message: "Validation Error"}}
-	case E99999:
-		return []IError{{Code: "E99999", Message: "Undefined Error"}}
+	return p.LocalizedErrors("")
+}
+
+func (p ErrorCode) LocalizedErrors(lang string) []IError {
+	return []IError{{Code: string(p.Definition().Code), Message: p.LocalizedMessage(lang, nil)}}
+}
+
+// エラーコードを付けたエラーを生成する
+func (p ErrorCode) Wrap(err error) *IAppError {
+	return &IAppError{Code: p, Err: err}
+}
+
+// ハンドラから返すとDefaultErrorHandlerがコードに応じたステータスとエラーを返す
+type IAppError struct {
+	Code   ErrorCode
+	Field  string
+	Params map[string]interface{}
+	Err    error // 原因
+}
+
+func NewAppError(code ErrorCode, params map[string]interface{}) *IAppError {
+	return &IAppError{Code: code, Params: params}
+}
+
+func (p *IAppError) Error() string {
+	if p.Err != nil {
+		return fmt.Sprintf("%s: %s", p.Code, p.Err)
+	}
+	return fmt.Sprintf("%s: %s", p.Code, p.Code.Message(p.Params))
+}
+
+func (p *IAppError) Unwrap() error {
+	return p.Err
+}
+
+func (p *IAppError) Errors() []IError {
+	return p.LocalizedErrors("")
+}
+
+func (p *IAppError) LocalizedErrors(lang string) []IError {
+	return []IError{{Code: string(p.Code.Definition().Code), Field: p.Field, Message: p.Code.LocalizedMessage(lang, p.Params)}}
+}
+
+// 登録済みのエラーコードを一覧で取得
+func ErrorCatalog() []*IErrorDefinition {
+	rs := []*IErrorDefinition{}
+	errorRegistry.Range(func(key, value interface{}) bool {
+		rs = append(rs, value.(*IErrorDefinition))
+		return true
+	})
+	sort.Slice(rs, func(i, j int) bool {
+		return rs[i].Code < rs[j].Code
+	})
+	return rs
+}
+
+// エラーコード一覧をjsonで出力
+func ErrorCatalogJson() string {
+	return ToPrettyJson(ErrorCatalog())
+}
+
+// エラーコード一覧をMarkdownの表で出力
+func ErrorCatalogMarkdown() string {
+	escape := strings.NewReplacer("|", "\\|", "\n", " ")
+	buf := bytes.NewBufferString("| Code | Status | Message | Description |\n| --- | --- | --- | --- |\n")
+	for _, def := range ErrorCatalog() {
+		fmt.Fprintf(buf, "| %s | %d | %s | %s |\n", def.Code, def.Status, escape.Replace(def.Message), escape.Replace(def.Description))
 	}
-	return []IError{{Code: "E99999", Message: "Undefined Error"}}
+	return buf.String()
 }
 
 type Errors struct {
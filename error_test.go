@@ -0,0 +1,62 @@
+package fiberextend_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	ext "github.com/h-nosaka/fiberextend"
+)
+
+var E40401 = ext.RegisterErrorCode("E40401", 404, "{{.name}} is not found", "指定のリソースが存在しません")
+
+func TestErrorCode(t *testing.T) {
+	test := ext.NewTest(t, ext.IFiberExConfig{})
+	test.Routes(func(ex *ext.IFiberEx) {
+		ex.App.Get("/users/:id", func(c *fiber.Ctx) error {
+			return ext.NewAppError(E40401, map[string]interface{}{"name": "user " + c.Params("id")})
+		})
+		ex.App.Get("/wrapped", func(c *fiber.Ctx) error {
+			return E40401.Wrap(errors.New("record not found"))
+		})
+		ex.App.Get("/plain", func(c *fiber.Ctx) error {
+			return errors.New("plain error")
+		})
+	})
+	test.Run("error code", func() {
+		test.Api("registered", &ext.ITestRequest{Method: "GET", Path: "/users/42"}, 404, []*ext.ITestCase{
+			{Path: "error.0.code", Want: "E40401"},
+			{Path: "error.0.message", Want: "user 42 is not found"},
+		}...)
+		test.Api("wrapped", &ext.ITestRequest{Method: "GET", Path: "/wrapped"}, 404, &ext.ITestCase{Path: "error.0.code", Want: "E40401"})
+		test.Api("plain", &ext.ITestRequest{Method: "GET", Path: "/plain"}, 500, &ext.ITestCase{Path: "error.0.code", Want: "E99999"})
+		test.Api("route not found", &ext.ITestRequest{Method: "GET", Path: "/not_found"}, 404)
+	})
+	if ext.ErrorCode("E00000").Status() != 500 {
+		t.Error("unknown code must fall back to E99999")
+	}
+	if md := ext.ErrorCatalogMarkdown(); !strings.Contains(md, "| E40401 | 404 |") {
+		t.Error(md)
+	}
+}
+
+func TestProblemJson(t *testing.T) {
+	test := ext.NewTest(t, ext.IFiberExConfig{ProblemTypeBase: "https://example.com/errors/"})
+	test.Routes(func(ex *ext.IFiberEx) {
+		ex.App.Get("/users/:id", func(c *fiber.Ctx) error {
+			return ext.NewAppError(E40401, map[string]interface{}{"name": "user " + c.Params("id")})
+		})
+	})
+	test.Run("problem", func() {
+		test.Api("accept", &ext.ITestRequest{Method: "GET", Path: "/users/42", Headers: map[string]string{"Accept": "application/problem+json"}}, 404, []*ext.ITestCase{
+			{Path: "type", Want: "https://example.com/errors/E40401"},
+			{Path: "title", Want: "Not Found"},
+			{Path: "status", Want: int64(404)},
+			{Path: "detail", Want: "user 42 is not found"},
+			{Method: ext.TestMethodNotEqual, Path: "instance", Want: nil},
+			{Path: "errors.0.code", Want: "E40401"},
+		}...)
+		test.Api("envelope", &ext.ITestRequest{Method: "GET", Path: "/users/42"}, 404, &ext.ITestCase{Path: "error.0.code", Want: "E40401"})
+	})
+}
@@ -0,0 +1,98 @@
+package fiberextend
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// 所要時間を除いたレスポンスから強いETagを生成する variantは表現形式ごとに値を変えるために使用する
+func responseETag(body *IResponse, variant string) (string, error) {
+	src := *body
+	if src.Meta != nil {
+		meta := *src.Meta
+		meta.Elapsed = ""
+		src.Meta = &meta
+	}
+	buf, err := json.Marshal(src)
+	if err != nil {
+		return "", err
+	}
+	if len(variant) > 0 {
+		buf = append(buf, variant...)
+	}
+	hash := sha256.Sum256(buf)
+	return fmt.Sprintf(`"%s"`, hex.EncodeToString(hash[:16])), nil
+}
+
+// Resultで返す場合と同じETagを生成する 更新前のリソースの比較に使用する
+func (p *IFiberEx) ETag(results ...interface{}) (string, error) {
+	body := &IResponse{Meta: &IMeta{}}
+	if len(results) > 1 {
+		body.Results = results
+	} else if len(results) == 1 {
+		body.Result = results[0]
+	}
+	return responseETag(body, "")
+}
+
+// If-None-Match/If-Matchの値にETagが含まれるか weakの場合はW/を無視して比較する
+func matchETag(header string, tag string, weak bool) bool {
+	for _, item := range strings.Split(header, ",") {
+		item = strings.TrimSpace(item)
+		if item == "*" {
+			return true
+		}
+		if weak {
+			item = strings.TrimPrefix(item, "W/")
+		} else if strings.HasPrefix(item, "W/") {
+			continue
+		}
+		if item == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// ETagを設定し、If-None-Matchと一致する場合は304を返す
+func (p *IFiberEx) resultETag(c *fiber.Ctx, body *IResponse, mime string) (bool, error) {
+	variant := ""
+	if mime != fiber.MIMEApplicationJSON {
+		variant = mime
+	}
+	tag, err := responseETag(body, variant)
+	if err != nil {
+		return false, err
+	}
+	c.Set(fiber.HeaderETag, tag)
+	if c.Method() != fiber.MethodGet && c.Method() != fiber.MethodHead {
+		return false, nil
+	}
+	if header := c.Get(fiber.HeaderIfNoneMatch); len(header) > 0 && matchETag(header, tag, true) {
+		return true, c.SendStatus(304)
+	}
+	return false, nil
+}
+
+// If-Matchが現在のリソースと一致しない場合は412を返す 処理を続行できる場合はtrue
+func (p *IFiberEx) CheckIfMatch(c *fiber.Ctx, current ...interface{}) bool {
+	header := c.Get(fiber.HeaderIfMatch)
+	if len(header) == 0 {
+		return true
+	}
+	tag, err := p.ETag(current...)
+	if err != nil {
+		_ = p.ResultAppError(c, err)
+		return false
+	}
+	if !matchETag(header, tag, false) {
+		_ = p.ResultAppError(c, E41201.Wrap(fmt.Errorf("precondition failed: %s != %s", header, tag)))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,40 @@
+package fiberextend_test
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	ext "github.com/h-nosaka/fiberextend"
+)
+
+func TestETag(t *testing.T) {
+	test := ext.NewTest(t, ext.IFiberExConfig{UseETag: true})
+	item := map[string]interface{}{"id": 1, "name": "foo"}
+	test.Routes(func(ex *ext.IFiberEx) {
+		ex.App.Get("/item", func(c *fiber.Ctx) error {
+			return ex.Result(c, 200, item)
+		})
+		ex.App.Put("/item", func(c *fiber.Ctx) error {
+			if !ex.CheckIfMatch(c, item) {
+				return nil
+			}
+			return ex.Result(c, 200, item)
+		})
+	})
+	tag, err := test.Ex.ETag(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.Run("if-none-match", func() {
+		test.Api("not modified", &ext.ITestRequest{Method: "GET", Path: "/item", Headers: map[string]string{"If-None-Match": tag}}, 304)
+		test.Api("weak match", &ext.ITestRequest{Method: "GET", Path: "/item", Headers: map[string]string{"If-None-Match": "W/" + tag}}, 304)
+		test.Api("modified", &ext.ITestRequest{Method: "GET", Path: "/item", Headers: map[string]string{"If-None-Match": `"other"`}}, 200,
+			&ext.ITestCase{Path: "result.name", Want: "foo"})
+	})
+	test.Run("if-match", func() {
+		test.Api("match", &ext.ITestRequest{Method: "PUT", Path: "/item", Headers: map[string]string{"If-Match": tag}}, 200)
+		test.Api("lost update", &ext.ITestRequest{Method: "PUT", Path: "/item", Headers: map[string]string{"If-Match": `"other"`}}, 412,
+			&ext.ITestCase{Path: "error.0.code", Want: "E41201"})
+		test.Api("no header", &ext.ITestRequest{Method: "PUT", Path: "/item"}, 200)
+	})
+}
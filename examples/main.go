@@ -78,10 +78,17 @@ func main() {
 			Addresses: []string{"es:9200"},
 		},
 	})
-	app := ex.NewApp()
+	// migrate <up|down|status|redo> の場合はマイグレーションのみ実行する
+	if name, _, ok, err := ex.RunCommand(); ok && name == ext.CommandMigrate {
+		if err != nil {
+			ex.Log.Fatal(err.Error())
+		}
+		return
+	}
+	ex.NewApp()
 	Routes(ex)
 
-	if err := app.Listen(":80"); err != nil {
+	if err := ex.Start(":80"); err != nil {
 		ex.Log.Fatal(err.Error())
 	}
 }
@@ -6,11 +6,14 @@ import (
 	"flag"
 	"fmt"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"dario.cat/mergo"
 	"github.com/elastic/go-elasticsearch/v8"
 	"github.com/getsentry/sentry-go"
+	ut "github.com/go-playground/universal-translator"
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -38,15 +41,22 @@ var Sentry *sentry.Client
 var background = context.Background()
 
 type IFiberEx struct {
-	NodeId    string
-	Config    IFiberExConfig
-	App       *fiber.App
-	Log       *zap.Logger
-	DB        *gorm.DB
-	Redis     *redis.Client
-	ES        *elasticsearch.Client
-	Sentry    *sentry.Client
-	Validator *validator.Validate
+	NodeId     string
+	Config     IFiberExConfig
+	App        *fiber.App
+	Log        *zap.Logger
+	GLog       glogger.Interface
+	DB         *gorm.DB
+	Redis      *redis.Client
+	ES         *elasticsearch.Client
+	Sentry     *sentry.Client
+	Validator  *validator.Validate
+	Hub        *IHub                   // WebSocketの接続管理
+	closing    atomic.Bool             // シャットダウン中
+	streams    sync.Map                // 接続中のSSE id:context.CancelFunc
+	docs       sync.Map                // ルートの説明 "METHOD path":*IRouteDoc
+	migrations iMigrations             // このインスタンスのマイグレーション
+	translator *ut.UniversalTranslator // メッセージの翻訳
 }
 
 type IFiberExConfig struct {
@@ -54,8 +64,12 @@ type IFiberExConfig struct {
 	DevMode  *bool
 	TestMode *bool
 	// 内部パラメータ
-	SecretToken   string
-	TokenExpireAt time.Duration
+	SecretToken        string
+	SecretTokenId      string            // 署名に使用する鍵ID
+	SecretTokenRotated map[string]string // ローテーション前の鍵 鍵ID:鍵 検証のみに使用する
+	TokenExpireAt      time.Duration
+	RefreshExpireAt    time.Duration
+	UseJwt             bool // JWT認証ミドルウェアを使用する
 	// fiber初期化パラメータ
 	IconFile         *string
 	IconUrl          *string
@@ -66,14 +80,35 @@ type IFiberExConfig struct {
 	DisableKeepalive *bool
 	ErrorHandler     func(*fiber.Ctx, error) error
 	AppName          *string
+	AppVersion       *string // OpenAPIのバージョン
 	BodyLimit        *int
+	UseETag          bool // ResultでETagを付与しIf-None-Matchに304で応答する
+	// 多言語対応 Accept-Languageが対応言語にない場合に使用する
+	DefaultLanguage *string
+	// エラーをRFC 7807(problem+json)で返す falseでもAcceptで要求された場合は返す
+	UseProblemJson  bool
+	ProblemTypeBase string // typeのURLの接頭辞 エラーコードを付与する 未指定はabout:blank
 	// サービスホスト
-	Host string
+	Host            string
+	ShutdownTimeout time.Duration // シャットダウン時の待ち時間
+	ShutdownDelay   time.Duration // readinessを落としてからHTTPを停止するまでの待ち時間
+	// WebSocket
+	UseWebSocket  bool // WebSocketPathにハブを追加する 接続には認証が必要
+	WebSocketPath *string
+	// ヘルスチェック
+	UseHealthCheck bool // /healthz, /readyz を追加する
+	HealthTimeout  time.Duration
+	UseMetrics     bool // MetricsPathに接続プールの状態を出力する
+	MetricsPath    *string
 	// ページング処理
-	PagePer *int
+	PagePer    *int
+	PagePerMax *int // 表示数の上限
 	// データベース接続
 	UseDB    bool
 	DBConfig *IDBConfig
+	// マイグレーション
+	MigrationDir         *string       // SQLファイルのディレクトリ 存在しない場合は登録済みのマイグレーションのみ実行する
+	MigrationLockTimeout time.Duration // 他のpodが実行中の場合に待つ時間
 	// キャッシュサーバ接続
 	UseRedis     bool
 	RedisOptions *redis.Options
@@ -106,6 +141,15 @@ type IDBConfig struct {
 	Addr       string
 	DBName     string
 	IsPostgres *bool
+	// 読み込み専用のレプリカ host:port ユーザ、パスワード、DB名はプライマリと同じ
+	Replicas             []string
+	ReplicaCheckInterval time.Duration // レプリカの疎通確認の間隔 失敗したレプリカは復旧するまで使用しない
+	// 接続プール レプリカにも同じ設定を使用する
+	MaxOpenConns    *int
+	MaxIdleConns    *int
+	ConnMaxLifetime time.Duration // プロキシ等に切断される前に接続を張り直す
+	ConnMaxIdleTime time.Duration
+	StatsInterval   time.Duration // 接続プールの状態をログに出力する間隔 0は出力しない
 }
 
 type IFiberExConfigOption struct {
@@ -157,13 +201,17 @@ func Int64(src int64) *int64 {
 	return &src
 }
 
+func Float64(src float64) *float64 {
+	return &src
+}
+
 func Bool(src bool) *bool {
 	return &src
 }
 
 func (p *IFiberEx) DefaultErrorHandler() func(*fiber.Ctx, error) error {
 	return func(c *fiber.Ctx, err error) error {
-		return p.ResultError(c, 500, err, E99999.Errors()...)
+		return p.ResultAppError(c, err)
 	}
 }
 
@@ -176,8 +224,21 @@ var defaultIFiberExConfig *IFiberExConfig = &IFiberExConfig{
 	Concurrency:      Int(256 * 1024),
 	DisableKeepalive: Bool(false),
 	AppName:          String("App"),
+	AppVersion:       String("1.0.0"),
 	BodyLimit:        Int(4 * 1024 * 1024),
 	PagePer:          Int(30),
+	PagePerMax:       Int(100),
+	WebSocketPath:    String("/ws"),
+	MetricsPath:      String("/metrics"),
+	MigrationDir:     String("migrations"),
+	DefaultLanguage:  String("en"),
+	SecretTokenId:    "default",
+	TokenExpireAt:    time.Hour,
+	RefreshExpireAt:  30 * 24 * time.Hour,
+	ShutdownTimeout:  30 * time.Second,
+	HealthTimeout:    3 * time.Second,
+
+	MigrationLockTimeout: time.Minute,
 }
 
 var defaultRedisOptions *redis.Options = &redis.Options{
@@ -198,6 +259,12 @@ var defaultDBConfig *IDBConfig = &IDBConfig{
 	Addr:   "db:3306",
 	DBName: "",
 	Config: &gorm.Config{},
+
+	ReplicaCheckInterval: 10 * time.Second,
+	MaxOpenConns:         Int(100),
+	MaxIdleConns:         Int(10),
+	ConnMaxLifetime:      30 * time.Minute,
+	ConnMaxIdleTime:      5 * time.Minute,
 }
 
 var defaultESConfig *elasticsearch.Config = &elasticsearch.Config{
@@ -209,6 +276,8 @@ var defaultESConfig *elasticsearch.Config = &elasticsearch.Config{
 	MaxRetries:    3,
 }
 
+// インスタンスごとにlogger、DB、Redis等の接続を生成する
+// 最初に生成したインスタンスはパッケージ変数(Ex, Log, DB...)の既定値として登録される
 func New(config IFiberExConfig) *IFiberEx {
 	// 設定の初期化
 	if err := mergo.Merge(&config, defaultIFiberExConfig); err != nil {
@@ -216,118 +285,142 @@ func New(config IFiberExConfig) *IFiberEx {
 	}
 
 	// logger初期化
-	if Log == nil {
-		var con zap.Config
-		if config.DevMode != nil && *config.DevMode {
-			con = zap.NewDevelopmentConfig()
-			if config.TestMode != nil && *config.TestMode {
-				con.Level.SetLevel(zap.ErrorLevel) // テストモードではエラーしかログ出力しない
-			}
-		} else {
-			con = zap.NewProductionConfig()
-		}
-		con.DisableCaller = true     // 呼び出し元は表示しない
-		con.DisableStacktrace = true // スタックトレースは表示しない
-		logger, err := con.Build()
-		if err != nil {
-			panic(err)
+	var con zap.Config
+	if config.DevMode != nil && *config.DevMode {
+		con = zap.NewDevelopmentConfig()
+		if config.TestMode != nil && *config.TestMode {
+			con.Level.SetLevel(zap.ErrorLevel) // テストモードではエラーしかログ出力しない
 		}
-		Log = logger
-		gzap := gormzap.New(Log,
-			gormzap.WithConfig(glogger.Config{
-				SlowThreshold:             200 * time.Millisecond,
-				Colorful:                  true,
-				IgnoreRecordNotFoundError: true,
-				LogLevel:                  glogger.Warn,
-			}),
-		)
-		GLog = &gzap
+	} else {
+		con = zap.NewProductionConfig()
+	}
+	con.DisableCaller = true     // 呼び出し元は表示しない
+	con.DisableStacktrace = true // スタックトレースは表示しない
+	logger, err := con.Build()
+	if err != nil {
+		panic(err)
+	}
+	glog := gormzap.New(logger,
+		gormzap.WithConfig(glogger.Config{
+			SlowThreshold:             200 * time.Millisecond,
+			Colorful:                  true,
+			IgnoreRecordNotFoundError: true,
+			LogLevel:                  glogger.Warn,
+		}),
+	)
+
+	ex := &IFiberEx{
+		Config: config,
+		Log:    logger,
+		GLog:   glog,
 	}
 
 	// DB初期化
-	if DB == nil && config.UseDB {
-		if config.DBConfig == nil {
-			config.DBConfig = &IDBConfig{}
+	if ex.Config.UseDB {
+		// 呼び出し元の設定を共有する他のインスタンスに影響しないように複製してから変更する
+		dbConfig := IDBConfig{}
+		if ex.Config.DBConfig != nil {
+			dbConfig = *ex.Config.DBConfig
+		}
+		gormConfig := gorm.Config{} // gorm.Configは接続ごとに必要
+		if dbConfig.Config != nil {
+			gormConfig = *dbConfig.Config
 		}
-		if err := mergo.Merge(config.DBConfig, defaultDBConfig); err != nil {
+		dbConfig.Config = &gormConfig
+		ex.Config.DBConfig = &dbConfig
+		if err := mergo.Merge(ex.Config.DBConfig, defaultDBConfig); err != nil {
 			panic(err)
 		}
-		if GLog != nil {
-			config.DBConfig.Config.Logger = *GLog
+		ex.Config.DBConfig.Config.Logger = glog
+		if ex.Config.TestMode != nil && *ex.Config.TestMode {
+			ex.Config.DBConfig.DBName += "_test"
 		}
-		if config.TestMode != nil && *config.TestMode {
-			config.DBConfig.DBName += "_test"
+		ex.DB = ex.Config.NewDB()
+		if ex.Config.DBConfig.StatsInterval > 0 {
+			go ex.logDBStats(ex.Config.DBConfig.StatsInterval)
 		}
-		DB = config.NewDB()
 	}
 
 	// Redis初期化
-	if Redis == nil && config.UseRedis {
-		if config.RedisOptions == nil {
-			config.RedisOptions = &redis.Options{}
+	if ex.Config.UseRedis {
+		options := redis.Options{}
+		if ex.Config.RedisOptions != nil {
+			options = *ex.Config.RedisOptions
 		}
-		if err := mergo.Merge(config.RedisOptions, defaultRedisOptions); err != nil {
+		ex.Config.RedisOptions = &options
+		if err := mergo.Merge(ex.Config.RedisOptions, defaultRedisOptions); err != nil {
 			panic(err)
 		}
-		Redis = config.NewRedis()
+		ex.Redis = ex.Config.NewRedis()
 	}
 
 	// ES初期化
-	if ES == nil && config.UseES {
-		if config.ESConfig == nil {
-			config.ESConfig = &elasticsearch.Config{}
+	if ex.Config.UseES {
+		esConfig := elasticsearch.Config{}
+		if ex.Config.ESConfig != nil {
+			esConfig = *ex.Config.ESConfig
 		}
-		if err := mergo.Merge(config.ESConfig, defaultESConfig); err != nil {
+		ex.Config.ESConfig = &esConfig
+		if err := mergo.Merge(ex.Config.ESConfig, defaultESConfig); err != nil {
 			panic(err)
 		}
-		ES = config.NewES()
+		ex.ES = ex.Config.NewES()
 	}
 
 	// Validator初期化
-	Validator = validator.New()
-	if err := Validator.RegisterValidation("match", ValidateMatch); err != nil {
+	ex.Validator = validator.New()
+	if err := ex.Validator.RegisterValidation("match", ValidateMatch); err != nil {
 		panic(err)
 	}
-	if err := Validator.RegisterValidation("password", ValidatePassword); err != nil {
+	if err := ex.Validator.RegisterValidation("password", ValidatePassword); err != nil {
 		panic(err)
 	}
+	ex.translator = newTranslator(ex.Validator)
 
 	// uuid
 	obj, err := uuid.NewRandom()
 	if err != nil {
 		panic(err)
 	}
+	ex.NodeId = obj.String()
 
 	// sentry
-	if config.SentryDsn != nil {
-		Sentry, err = sentry.NewClient(sentry.ClientOptions{
-			Dsn:              *config.SentryDsn,
-			Environment:      config.SentryEnv,
+	if ex.Config.SentryDsn != nil {
+		ex.Sentry, err = sentry.NewClient(sentry.ClientOptions{
+			Dsn:              *ex.Config.SentryDsn,
+			Environment:      ex.Config.SentryEnv,
 			TracesSampleRate: 1.0,
 		})
 		if err != nil {
 			panic(err)
 		}
-		if config.SentryScope != nil {
-			config.SentryScope = sentry.NewScope()
+		if ex.Config.SentryScope != nil {
+			ex.Config.SentryScope = sentry.NewScope()
 		}
 	}
 
-	Log.Info("fiberextend.New", zap.String("NodeId", obj.String()))
+	ex.Log.Info("fiberextend.New", zap.String("NodeId", ex.NodeId))
 
-	Ex = &IFiberEx{
-		NodeId:    obj.String(),
-		Config:    config,
-		Log:       Log,
-		DB:        DB,
-		Redis:     Redis,
-		ES:        ES,
-		Validator: Validator,
-		Sentry:    Sentry,
+	if Ex == nil {
+		ex.SetDefault()
 	}
-	return Ex
+	return ex
+}
+
+// パッケージ変数の既定値をこのインスタンスにする
+func (p *IFiberEx) SetDefault() {
+	Ex = p
+	Log = p.Log
+	GLog = &p.GLog
+	DB = p.DB
+	Redis = p.Redis
+	ES = p.ES
+	Validator = p.Validator
+	Sentry = p.Sentry
 }
 
+// コマンドライン引数を解析する "run <name> args..." または "migrate <command> args..."
+// migrateの場合はCommandMigrateと引数を返す 引数はそのままMigrateに渡す
 func RunCommand() (string, []string, bool) {
 	flag.Parse()
 	args := flag.Args()
@@ -336,9 +429,22 @@ func RunCommand() (string, []string, bool) {
 			return args[1], args[2:], true
 		}
 	}
+	if len(args) > 0 && args[0] == CommandMigrate {
+		return CommandMigrate, args[1:], true
+	}
 	return "", args, false
 }
 
+// コマンドライン引数を解析し、migrateの場合はマイグレーションを実行する 戻り値はRunCommandと同じ
+// errはMigrateの結果 migrateを実行した場合、呼び出し元はサーバを起動せずに終了する
+func (p *IFiberEx) RunCommand() (string, []string, bool, error) {
+	name, args, ok := RunCommand()
+	if ok && name == CommandMigrate {
+		return name, args, ok, p.Migrate(args...)
+	}
+	return name, args, ok, nil
+}
+
 func (p *IFiberEx) NewApp() *fiber.App {
 	errHandler := p.DefaultErrorHandler()
 	if p.Config.ErrorHandler != nil {
@@ -361,6 +467,9 @@ func (p *IFiberEx) NewApp() *fiber.App {
 	}))
 	app.Use(requestid.New())
 	app.Use(zapLogger(p.Log))
+	if p.Config.UseJwt {
+		app.Use(p.JwtMiddleware())
+	}
 	if p.Config.IconFile != nil {
 		app.Use(favicon.New(favicon.Config{
 			File: *p.Config.IconFile,
@@ -373,10 +482,24 @@ func (p *IFiberEx) NewApp() *fiber.App {
 		app.Use(favicon.New())
 	}
 
+	if p.Config.UseHealthCheck {
+		app.Get("/healthz", p.LivenessHandler())
+		app.Get("/readyz", p.ReadinessHandler())
+	}
+
+	if p.Config.UseMetrics {
+		app.Get(*p.Config.MetricsPath, p.MetricsHandler())
+	}
+
+	if p.Config.UseWebSocket {
+		app.Get(*p.Config.WebSocketPath, p.WebSocketHandler())
+	}
+
 	if p.Config.DevMode != nil && *p.Config.DevMode {
+		app.Get("/docs/openapi.json", p.OpenAPIHandler()) // 登録済みのルートから生成する
 		app.Static("docs/", "./docs")
 		app.Get("/swagger/*", swagger.New(swagger.Config{
-			URL:          fmt.Sprintf("http://%s/docs/swagger.json", p.Config.Host),
+			URL:          fmt.Sprintf("http://%s/docs/openapi.json", p.Config.Host),
 			DeepLinking:  false,
 			DocExpansion: "none",
 		}))
@@ -402,12 +525,36 @@ func (p *IFiberEx) IpAddr() string {
 	return ip
 }
 
+// DBの接続プールを作り直す p.DBは差し替えないため、実行中のリクエストはそのまま完了する
+// 1秒以内に再接続していた場合は何もしない
 func (p *IFiberEx) ReconnectDB() {
-	p.ClearPreparedStatements()
-	db, _ := p.DB.DB()
-	defer db.Close() // 元の接続はcloseする
-	DB = p.Config.NewDB()
-	p.DB = DB
+	pool, ok := p.DB.Config.ConnPool.(*iConnPool)
+	if stmts, prepared := p.DB.Config.ConnPool.(*gorm.PreparedStmtDB); prepared {
+		pool, ok = stmts.ConnPool.(*iConnPool)
+	}
+	if !ok {
+		p.LogError(errors.New("DBの接続プールが差し替えできないため再接続しない"))
+		return
+	}
+	old, err := pool.reconnect(time.Second)
+	if err != nil {
+		p.LogError(err)
+		return
+	}
+	if old == nil {
+		return
+	}
+	if stmts, prepared := p.DB.Config.ConnPool.(*gorm.PreparedStmtDB); prepared {
+		stmts.Mux.Lock()
+		stmts.Stmts = map[string]*gorm.Stmt{} // 元のプールのprepared statementは使わない
+		stmts.Mux.Unlock()
+	}
+	p.LogInfo("fiberextend.ReconnectDB")
+	go func() {
+		if err := old.Close(); err != nil { // 実行中のクエリの完了を待つ
+			p.LogError(err)
+		}
+	}()
 }
 
 func (p *IFiberEx) ClearPreparedStatements() {
@@ -418,9 +565,9 @@ func (p *IFiberEx) ClearPreparedStatements() {
 	}
 }
 
+// キャッシュ不整合のエラーが発生した場合はDBに再接続する
 func (p *IFiberEx) CatchPreparedStatementsError(err error) {
-	if err.Error() == "ERROR: cached plan must not change result type (SQLSTATE 0A000)" {
-		// 上記エラーが発生したらDBに再接続する
+	if ClassifyDBError(err) == DBErrorCachedPlan {
 		p.LogError(errors.New("キャッシュエラーのためDBに再接続"))
 		p.ReconnectDB()
 	}
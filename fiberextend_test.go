@@ -1,7 +1,61 @@
 package fiberextend
 
-import "testing"
+import (
+	"testing"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
 
 func TestNew(t *testing.T) {
 	t.Error("test")
 }
+
+func TestNewInstances(t *testing.T) {
+	r1 := miniredis.RunT(t)
+	r2 := miniredis.RunT(t)
+	ex1 := New(IFiberExConfig{UseRedis: true, RedisOptions: &redis.Options{Addr: r1.Addr()}})
+	ex2 := New(IFiberExConfig{UseRedis: true, RedisOptions: &redis.Options{Addr: r2.Addr()}})
+	if ex1.Redis == ex2.Redis || ex1.Log == ex2.Log || ex1.Validator == ex2.Validator {
+		t.Error("instances must not share dependencies")
+	}
+	if err := ex2.Redis.Set(background, "key", "ex2", 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if r1.Exists("key") {
+		t.Error("ex2 must not write to ex1 redis")
+	}
+	if Ex == ex2 {
+		t.Error("second instance must not replace the default")
+	}
+	ex2.SetDefault()
+	if Ex != ex2 || Redis != ex2.Redis {
+		t.Error("SetDefault must replace the default")
+	}
+}
+
+func TestNewSharedConfig(t *testing.T) {
+	r := miniredis.RunT(t)
+	config := IFiberExConfig{
+		TestMode:     Bool(true),
+		UseDB:        true,
+		DBConfig:     &IDBConfig{IsPostgres: Bool(true), Addr: "127.0.0.1:1", DBName: "app", Config: &gorm.Config{DisableAutomaticPing: true}},
+		UseRedis:     true,
+		RedisOptions: &redis.Options{Addr: r.Addr()},
+	}
+	ex1 := New(config)
+	ex2 := New(config)
+	if config.DBConfig.DBName != "app" || config.DBConfig.Config.Logger != nil || config.DBConfig.MaxOpenConns != nil {
+		t.Errorf("caller config must not be changed: %+v", config.DBConfig)
+	}
+	if ex1.Config.DBConfig.DBName != "app_test" || ex2.Config.DBConfig.DBName != "app_test" {
+		t.Errorf("dbname: %s, %s", ex1.Config.DBConfig.DBName, ex2.Config.DBConfig.DBName)
+	}
+	if ex1.Config.DBConfig.Config.Logger != ex1.GLog || ex2.Config.DBConfig.Config.Logger != ex2.GLog {
+		t.Error("gorm logger must belong to each instance")
+	}
+	if ex1.Config.RedisOptions == config.RedisOptions || ex1.Config.RedisOptions == ex2.Config.RedisOptions {
+		t.Error("redis options must be copied")
+	}
+}
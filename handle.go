@@ -0,0 +1,129 @@
+package fiberextend
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// 型付きハンドラ リクエストは構造体に、戻り値はresultに変換される
+type IHandlerFunc[Req any, Res any] func(c *fiber.Ctx, req Req) (Res, error)
+
+// 構造体のタグから読み込むリクエストの部分
+type requestBinding struct {
+	query  bool
+	params bool
+	header bool
+	body   bool
+}
+
+func newRequestBinding(typ reflect.Type) requestBinding {
+	rs := requestBinding{}
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return rs
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		_, query := field.Tag.Lookup("query")
+		_, params := field.Tag.Lookup("params")
+		_, header := field.Tag.Lookup("reqHeader")
+		rs.query = rs.query || query
+		rs.params = rs.params || params
+		rs.header = rs.header || header
+		rs.body = rs.body || isBodyField(field)
+	}
+	return rs
+}
+
+// ボディに含まれるフィールド query/params/reqHeaderタグのみのフィールドは除く
+func isBodyField(field reflect.StructField) bool {
+	if _, ok := field.Tag.Lookup("json"); ok {
+		return true
+	}
+	for _, tag := range []string{"query", "params", "reqHeader"} {
+		if _, ok := field.Tag.Lookup(tag); ok {
+			return false
+		}
+	}
+	return true
+}
+
+// ボディ(json)、クエリ、ヘッダ、パスパラメータの順に読み込む 後に読み込んだ値が優先される
+func (p requestBinding) bind(c *fiber.Ctx, out interface{}) error {
+	if p.body && c.Method() != fiber.MethodGet && c.Method() != fiber.MethodHead && len(c.Body()) > 0 {
+		if err := json.Unmarshal(c.Body(), out); err != nil { // BodyParserは型変換がおかしくなるので使わない
+			return err
+		}
+	}
+	if p.query || c.Method() == fiber.MethodGet { // RequestParserと同じくGETはタグがなくてもクエリを読む
+		if err := c.QueryParser(out); err != nil {
+			return err
+		}
+	}
+	if p.header {
+		if err := c.ReqHeaderParser(out); err != nil {
+			return err
+		}
+	}
+	if p.params {
+		if err := c.ParamsParser(out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ルートを登録し、リクエストとレスポンスの型をOpenAPIに記録する middlewaresはhandlerの前に実行する
+func HandleRoute[Req any, Res any](ex *IFiberEx, router fiber.Router, method string, path string, handler IHandlerFunc[Req, Res], middlewares ...fiber.Handler) fiber.Router {
+	var req Req
+	var res Res
+	ex.docTypes(method, routePath(router, path), IRouteDoc{Request: req, Response: res, Results: isResultsType(reflect.TypeOf(res))})
+	return router.Add(method, path, append(middlewares, Handle(ex, handler))...)
+}
+
+// スライスはresultsで返す
+func isResultsType(typ reflect.Type) bool {
+	return typ != nil && typ.Kind() == reflect.Slice
+}
+
+// リクエストの読み込み、バリデーション、結果の出力を行うハンドラを生成する
+// 成功時はPOSTが201、それ以外は200を返す スライスはresultsで返す エラーはResultAppErrorで返す
+func Handle[Req any, Res any](ex *IFiberEx, handler IHandlerFunc[Req, Res]) fiber.Handler {
+	var zero Req
+	binding := newRequestBinding(reflect.TypeOf(zero))
+	var res Res
+	results := isResultsType(reflect.TypeOf(res))
+	return func(c *fiber.Ctx) error {
+		ex.docRoute(c, IRouteDoc{Request: zero, Response: res, Results: results})
+		var req Req
+		if err := binding.bind(c, &req); err != nil {
+			return ex.ResultError(c, 400, err, IError{Code: string(E40001), Message: err.Error()})
+		}
+		if reflect.ValueOf(req).Kind() == reflect.Struct {
+			if errs := ex.LocalizedValidation(c, req); len(errs) > 0 {
+				return ex.ResultError(c, 400, fmt.Errorf("validation error: %+v", errs), errs...)
+			}
+		}
+		rs, err := handler(c, req)
+		if err != nil {
+			return ex.ResultAppError(c, err)
+		}
+		if c.Response().IsBodyStream() { // ハンドラ内でストリームを返した場合
+			return nil
+		}
+		status := 200
+		if c.Method() == fiber.MethodPost {
+			status = 201
+		}
+		body := &IResponse{Result: rs}
+		if results {
+			body = &IResponse{Results: responseItems(body)}
+		}
+		return ex.result(c, status, body)
+	}
+}
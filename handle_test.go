@@ -0,0 +1,83 @@
+package fiberextend_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	ext "github.com/h-nosaka/fiberextend"
+)
+
+type handleRequest struct {
+	Id    int    `params:"id"`
+	Token string `reqHeader:"X-Token" validate:"required"`
+	Dry   bool   `query:"dry"`
+	Name  string `json:"name" validate:"required,match=^[a-z]+$"`
+}
+
+type handleSearch struct {
+	Keyword string `query:"q"`
+}
+
+func TestHandle(t *testing.T) {
+	test := ext.NewTest(t, ext.IFiberExConfig{})
+	test.Routes(func(ex *ext.IFiberEx) {
+		ex.App.Put("/users/:id", ext.Handle(ex, func(c *fiber.Ctx, req handleRequest) (map[string]interface{}, error) {
+			if req.Name == "taken" {
+				return nil, ext.E40901.Wrap(errors.New("name is taken"))
+			}
+			return map[string]interface{}{"id": req.Id, "name": req.Name, "dry": req.Dry, "token": req.Token}, nil
+		}))
+		ex.App.Get("/users", ext.Handle(ex, func(c *fiber.Ctx, req handleSearch) ([]string, error) {
+			return []string{req.Keyword, "bar"}, nil
+		}))
+	})
+	headers := map[string]string{"X-Token": "token1"}
+	test.Run("bind", func() {
+		test.Api("params, header, query and body", &ext.ITestRequest{
+			Method:  "PUT",
+			Path:    "/users/12",
+			Headers: headers,
+			Query:   &map[string]string{"dry": "true"},
+			Body:    map[string]interface{}{"name": "foo"},
+		}, 200, []*ext.ITestCase{
+			{Path: "result.id", Want: int64(12)},
+			{Path: "result.name", Want: "foo"},
+			{Path: "result.dry", Want: true},
+			{Path: "result.token", Want: "token1"},
+		}...)
+		test.Api("results", &ext.ITestRequest{Method: "GET", Path: "/users", Query: &map[string]string{"q": "foo"}}, 200,
+			&ext.ITestCase{Path: "results.0", Want: "foo"},
+			&ext.ITestCase{Path: "results.1", Want: "bar"},
+		)
+	})
+	test.Run("error", func() {
+		test.Api("validation", &ext.ITestRequest{Method: "PUT", Path: "/users/12", Body: map[string]interface{}{"name": "Foo"}}, 400,
+			&ext.ITestCase{Path: "error.0.code", Want: "E40001"},
+			&ext.ITestCase{Path: "error", Method: ext.TestMethodLen, Want: 2},
+		)
+		test.Api("invalid param", &ext.ITestRequest{Method: "PUT", Path: "/users/abc", Headers: headers, Body: map[string]interface{}{"name": "foo"}}, 400,
+			&ext.ITestCase{Path: "error.0.code", Want: "E40001"},
+		)
+		test.Api("typed error", &ext.ITestRequest{Method: "PUT", Path: "/users/12", Headers: headers, Body: map[string]interface{}{"name": "taken"}}, 409,
+			&ext.ITestCase{Path: "error.0.code", Want: "E40901"},
+		)
+	})
+	test.Run("openapi", func() {
+		op := test.Ex.OpenAPI().Paths["/users/{id}"]["put"]
+		if op == nil || op.RequestBody == nil {
+			t.Fatalf("put /users/{id}: %+v", op)
+		}
+		in := map[string]string{}
+		for _, param := range op.Parameters {
+			in[param.Name] = param.In
+		}
+		if in["id"] != "path" || in["X-Token"] != "header" || in["dry"] != "query" {
+			t.Errorf("parameters: %+v", in)
+		}
+		schema := test.Ex.OpenAPI().Components.Schemas["github.com.h-nosaka.fiberextend_test.handleRequest"]
+		if _, ok := schema.Properties["name"]; !ok || len(schema.Properties) != 1 {
+			t.Errorf("body: %+v", schema.Properties)
+		}
+	})
+}
@@ -0,0 +1,140 @@
+package fiberextend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jrallison/go-workers"
+)
+
+type IHealth struct {
+	Status string          `json:"status"` // ok or error
+	NodeId string          `json:"node_id"`
+	Checks []*IHealthCheck `json:"checks,omitempty"`
+}
+
+type IHealthCheck struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"` // ok or error
+	Latency string `json:"latency"`
+	Error   string `json:"error,omitempty"`
+}
+
+const (
+	HealthStatusOk    = "ok"
+	HealthStatusError = "error"
+)
+
+// 有効な接続先ごとの疎通確認
+func (p *IFiberEx) healthChecks() map[string]func(ctx context.Context) error {
+	checks := map[string]func(ctx context.Context) error{}
+	if p.Config.UseDB && p.DB != nil {
+		checks["db"] = func(ctx context.Context) error {
+			db, err := p.DB.DB()
+			if err != nil {
+				return err
+			}
+			return db.PingContext(ctx)
+		}
+	}
+	if p.Config.UseRedis && p.Redis != nil {
+		checks["redis"] = func(ctx context.Context) error {
+			return p.Redis.Ping(ctx).Err()
+		}
+	}
+	if p.Config.UseES && p.ES != nil {
+		checks["es"] = func(ctx context.Context) error {
+			res, err := p.ES.Cluster.Health(p.ES.Cluster.Health.WithContext(ctx))
+			if err != nil {
+				return err
+			}
+			defer res.Body.Close()
+			if res.IsError() {
+				return fmt.Errorf("es error: %s", res.Status())
+			}
+			body := map[string]interface{}{}
+			if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+				return err
+			}
+			if body["status"] == "red" {
+				return fmt.Errorf("es cluster status: red")
+			}
+			return nil
+		}
+	}
+	if JobAlive && workers.Config != nil {
+		checks["job"] = func(ctx context.Context) error {
+			conn, err := workers.Config.Pool.GetContext(ctx)
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+			_, err = conn.Do("PING")
+			return err
+		}
+	}
+	return checks
+}
+
+// 全ての接続先を並行して確認する
+func (p *IFiberEx) Health() *IHealth {
+	ctx, cancel := context.WithTimeout(background, p.Config.HealthTimeout)
+	defer cancel()
+	rs := &IHealth{
+		Status: HealthStatusOk,
+		NodeId: p.NodeId,
+		Checks: []*IHealthCheck{},
+	}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for name, check := range p.healthChecks() {
+		wg.Add(1)
+		go func(name string, check func(ctx context.Context) error) {
+			defer wg.Done()
+			start := time.Now()
+			item := &IHealthCheck{Name: name, Status: HealthStatusOk}
+			if err := check(ctx); err != nil {
+				item.Status = HealthStatusError
+				item.Error = err.Error()
+			}
+			item.Latency = time.Since(start).String()
+			mu.Lock()
+			defer mu.Unlock()
+			rs.Checks = append(rs.Checks, item)
+			if item.Status != HealthStatusOk {
+				rs.Status = HealthStatusError
+			}
+		}(name, check)
+	}
+	wg.Wait()
+	sort.Slice(rs.Checks, func(i, j int) bool {
+		return rs.Checks[i].Name < rs.Checks[j].Name
+	})
+	return rs
+}
+
+// /healthz: プロセスの生存確認 接続先の状態は参考として返す
+func (p *IFiberEx) LivenessHandler() func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		return p.Result(c, 200, p.Health())
+	}
+}
+
+// /readyz: 接続先が全て正常かつシャットダウン中でない場合のみ200を返す
+func (p *IFiberEx) ReadinessHandler() func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		rs := p.Health()
+		if p.IsShuttingDown() {
+			rs.Status = HealthStatusError
+		}
+		if rs.Status != HealthStatusOk {
+			return p.Result(c, 503, rs)
+		}
+		return p.Result(c, 200, rs)
+	}
+}
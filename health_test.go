@@ -0,0 +1,35 @@
+package fiberextend_test
+
+import (
+	"testing"
+
+	ext "github.com/h-nosaka/fiberextend"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestHealth(t *testing.T) {
+	test := ext.NewTest(t, ext.IFiberExConfig{
+		UseRedis:       true,
+		RedisOptions:   &redis.Options{MaxRetries: -1},
+		UseHealthCheck: true,
+	})
+	test.Run("healthy", func() {
+		test.Api("healthz", &ext.ITestRequest{Method: "GET", Path: "/healthz"}, 200, []*ext.ITestCase{
+			{Path: "result.status", Want: "ok"},
+			{Path: "result.checks.0.name", Want: "redis"},
+		}...)
+		test.Api("readyz", &ext.ITestRequest{Method: "GET", Path: "/readyz"}, 200, []*ext.ITestCase{
+			{Path: "result.status", Want: "ok"},
+		}...)
+	})
+	test.Run("unhealthy", func() {
+		test.Redis.SetError("down")
+		defer test.Redis.SetError("")
+		test.Api("healthz", &ext.ITestRequest{Method: "GET", Path: "/healthz"}, 200, []*ext.ITestCase{
+			{Path: "result.status", Want: "error"},
+		}...)
+		test.Api("readyz", &ext.ITestRequest{Method: "GET", Path: "/readyz"}, 503, []*ext.ITestCase{
+			{Path: "result.checks.0.status", Want: "error"},
+		}...)
+	})
+}
@@ -0,0 +1,117 @@
+package fiberextend
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/ja"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	en_translations "github.com/go-playground/validator/v10/translations/en"
+	ja_translations "github.com/go-playground/validator/v10/translations/ja"
+	"github.com/gofiber/fiber/v2"
+)
+
+// 対応言語
+var Languages = []string{"en", "ja"}
+
+// 独自バリデーションのメッセージ {0}はフィールド名、{1}はパラメータ
+var customValidationMessages = map[string]map[string]string{
+	"en": {
+		"match":    "{0} has an invalid format",
+		"password": "{0} must be at least {1} characters and contain upper and lower case letters, numbers and symbols",
+	},
+	"ja": {
+		"match":    "{0}の形式が正しくありません",
+		"password": "{0}は大文字、小文字、数字、記号を含む{1}文字以上にしてください",
+	},
+}
+
+// バリデーションメッセージの翻訳を初期化する
+func newTranslator(v *validator.Validate) *ut.UniversalTranslator {
+	uni := ut.New(en.New(), en.New(), ja.New())
+	// メッセージのフィールド名はjsonタグを使う
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" || len(name) == 0 {
+			return field.Name
+		}
+		return name
+	})
+	for _, lang := range Languages {
+		trans, _ := uni.GetTranslator(lang)
+		var err error
+		switch lang {
+		case "ja":
+			err = ja_translations.RegisterDefaultTranslations(v, trans)
+		default:
+			err = en_translations.RegisterDefaultTranslations(v, trans)
+		}
+		if err != nil {
+			panic(err)
+		}
+		for tag, message := range customValidationMessages[lang] {
+			message := message
+			if err := v.RegisterTranslation(tag, trans, func(ut ut.Translator) error {
+				return ut.Add(tag, message, true)
+			}, translateCustomValidation); err != nil {
+				panic(err)
+			}
+		}
+	}
+	return uni
+}
+
+func translateCustomValidation(trans ut.Translator, fe validator.FieldError) string {
+	param := fe.Param()
+	if fe.Tag() == "password" && len(param) == 0 {
+		param = "10" // ValidatePasswordの既定値
+	}
+	rs, err := trans.T(fe.Tag(), fe.Field(), param)
+	if err != nil {
+		return fe.Error()
+	}
+	return rs
+}
+
+// Accept-Languageから対応言語を選ぶ 該当がない場合は既定の言語
+func (p *IFiberEx) Lang(c *fiber.Ctx) string {
+	type item struct {
+		lang string
+		q    float64
+	}
+	items := []item{}
+	for _, src := range strings.Split(c.Get(fiber.HeaderAcceptLanguage), ",") {
+		parts := strings.Split(strings.TrimSpace(src), ";")
+		q := 1.0
+		for _, param := range parts[1:] {
+			if value, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if rs, err := strconv.ParseFloat(value, 64); err == nil {
+					q = rs
+				}
+			}
+		}
+		lang := strings.ToLower(strings.SplitN(strings.TrimSpace(parts[0]), "-", 2)[0])
+		items = append(items, item{lang: lang, q: q})
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].q > items[j].q
+	})
+	for _, item := range items {
+		for _, lang := range Languages {
+			if item.lang == lang {
+				return lang
+			}
+		}
+	}
+	return *p.Config.DefaultLanguage
+}
+
+// 言語の翻訳を取得
+func (p *IFiberEx) Translator(lang string) ut.Translator {
+	trans, _ := p.translator.FindTranslator(lang, *p.Config.DefaultLanguage)
+	return trans
+}
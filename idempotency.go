@@ -0,0 +1,99 @@
+package fiberextend
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+type IIdempotency struct {
+	Header      string        // キーを受け取るヘッダ 既定はIdempotency-Key
+	Expire      time.Duration // 結果の保存期間
+	LockTimeout time.Duration // 最初のリクエストの処理中ロック
+}
+
+type IIdempotencyEntry struct {
+	Hash        string `json:"hash"` // リクエストボディのハッシュ
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type"`
+	Body        string `json:"body"`
+}
+
+// Idempotency-Keyが同じリクエストには最初の結果を返す POST/PATCHのみ対象
+func (p *IFiberEx) Idempotency(config IIdempotency) func(*fiber.Ctx) error {
+	if len(config.Header) == 0 {
+		config.Header = "Idempotency-Key"
+	}
+	if config.Expire == 0 {
+		config.Expire = 24 * time.Hour
+	}
+	if config.LockTimeout == 0 {
+		config.LockTimeout = 30 * time.Second
+	}
+	return func(c *fiber.Ctx) error {
+		if c.Method() != fiber.MethodPost && c.Method() != fiber.MethodPatch {
+			return c.Next()
+		}
+		id := c.Get(config.Header)
+		if len(id) == 0 {
+			return c.Next()
+		}
+		ctx := c.UserContext()
+		key := fmt.Sprintf("idempotency:%s:%s:%s:%s", c.Locals("userid"), c.Method(), c.Path(), id)
+		sum := sha256.Sum256(c.Body())
+		hash := hex.EncodeToString(sum[:])
+		// 保存済みの結果があれば返す ボディが異なる場合は422
+		replay := func() (bool, error) {
+			entry := &IIdempotencyEntry{}
+			if err := p.GetRedisJson(entry, key); err != nil || entry.Status == 0 {
+				return false, nil
+			}
+			if entry.Hash != hash {
+				return true, p.ResultAppError(c, E42201.Wrap(fmt.Errorf("idempotency key reused with different body: %s", id)))
+			}
+			c.Set("Idempotent-Replayed", "true")
+			c.Set(fiber.HeaderContentType, entry.ContentType)
+			return true, c.Status(entry.Status).SendString(entry.Body)
+		}
+		if ok, err := replay(); ok {
+			return err
+		}
+
+		token := uuid.NewString()
+		locked, err := p.Redis.SetNX(ctx, "lock:"+key, token, config.LockTimeout).Result()
+		if err != nil {
+			p.LogError(err, p.ApiLogFields(c, zap.String("idempotency", key))...)
+			return c.Next()
+		}
+		if !locked {
+			return p.ResultAppError(c, E40901.Wrap(fmt.Errorf("idempotency key in progress: %s", id)))
+		}
+		defer unlockScript.Run(ctx, p.Redis, []string{"lock:" + key}, token)
+		// 最初の確認からロック取得までの間に先行リクエストが完了している場合があるため再確認する
+		if ok, err := replay(); ok {
+			return err
+		}
+
+		if err := c.Next(); err != nil {
+			return err
+		}
+		if c.Response().StatusCode() >= 500 { // サーバエラーは再試行できるように保存しない
+			return nil
+		}
+		entry := &IIdempotencyEntry{
+			Hash:        hash,
+			Status:      c.Response().StatusCode(),
+			ContentType: string(c.Response().Header.ContentType()),
+			Body:        string(c.Response().Body()),
+		}
+		if err := p.SetRedisJson(key, entry, config.Expire); err != nil {
+			p.LogError(err, p.ApiLogFields(c, zap.String("idempotency", key))...)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,46 @@
+package fiberextend_test
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	ext "github.com/h-nosaka/fiberextend"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestIdempotency(t *testing.T) {
+	test := ext.NewTest(t, ext.IFiberExConfig{
+		UseRedis:     true,
+		RedisOptions: &redis.Options{},
+	})
+	count := 0
+	test.Routes(func(ex *ext.IFiberEx) {
+		ex.App.Post("/orders", ex.Idempotency(ext.IIdempotency{}), func(c *fiber.Ctx) error {
+			count++
+			return ex.Result(c, 201, map[string]interface{}{"count": count})
+		})
+		ex.App.Post("/expired", ex.Idempotency(ext.IIdempotency{}), func(c *fiber.Ctx) error {
+			// ロックの期限切れ後に別のリクエストがロックを取得した状態
+			if err := ex.Redis.Set(c.UserContext(), "lock:idempotency:-:POST:/expired:key3", "other", 0).Err(); err != nil {
+				return err
+			}
+			return ex.Result(c, 201, nil)
+		})
+	})
+	test.Run("idempotency", func() {
+		headers := map[string]string{"Idempotency-Key": "key1"}
+		body := map[string]interface{}{"item": 1}
+		test.Api("first", &ext.ITestRequest{Method: "POST", Path: "/orders", Headers: headers, Body: body}, 201, &ext.ITestCase{Path: "result.count", Want: int64(1)})
+		test.Api("retry", &ext.ITestRequest{Method: "POST", Path: "/orders", Headers: headers, Body: body}, 201, &ext.ITestCase{Path: "result.count", Want: int64(1)})
+		test.Api("mismatch", &ext.ITestRequest{Method: "POST", Path: "/orders", Headers: headers, Body: map[string]interface{}{"item": 2}}, 422, &ext.ITestCase{Path: "error.0.code", Want: "E42201"})
+		test.Api("no key", &ext.ITestRequest{Method: "POST", Path: "/orders", Body: body}, 201, &ext.ITestCase{Path: "result.count", Want: int64(2)})
+		if err := test.Redis.Set("lock:idempotency:-:POST:/orders:key2", "other"); err != nil {
+			t.Error(err)
+		}
+		test.Api("in progress", &ext.ITestRequest{Method: "POST", Path: "/orders", Headers: map[string]string{"Idempotency-Key": "key2"}, Body: body}, 409, &ext.ITestCase{Path: "error.0.code", Want: "E40901"})
+		test.Api("expired lock", &ext.ITestRequest{Method: "POST", Path: "/expired", Headers: map[string]string{"Idempotency-Key": "key3"}, Body: body}, 201)
+		if value, err := test.Redis.Get("lock:idempotency:-:POST:/expired:key3"); err != nil || value != "other" {
+			t.Errorf("lock of other request was released: %s, %v", value, err)
+		}
+	})
+}
@@ -20,25 +20,28 @@ type IJob struct {
 	Class       string                 // スケジュール実行時のクラス名
 	Args        func() interface{}     // スケジュール実行時のパラメータ
 	Middlewares []workers.Action       // ジョブ特有のアクション
+	ex          *IFiberEx              // 登録したインスタンス
 }
 
-type jobInfo struct{}
+type jobInfo struct {
+	ex *IFiberEx
+}
 
 func (p jobInfo) Call(queue string, msg *workers.Msg, next func() bool) bool {
 	// 初期化
-	Log.Info(fmt.Sprintf("job start: %s", queue), zap.Any("msg", msg))
+	p.ex.Log.Info(fmt.Sprintf("job start: %s", queue), zap.Any("msg", msg))
 	// 処理
 	ok := next()
 	// 終了処理
-	Log.Info(fmt.Sprintf("job finish: %s", queue), zap.Any("msg", msg))
+	p.ex.Log.Info(fmt.Sprintf("job finish: %s", queue), zap.Any("msg", msg))
 	return ok
 }
 
 func (p IJob) Run() {
-	if Ex.checkCronNode() { // cronはシングルノードで動作するようにチェックする
-		Log.Info("scheduled job start", zap.Any("job", p))
+	if p.ex.checkCronNode() { // cronはシングルノードで動作するようにチェックする
+		p.ex.Log.Info("scheduled job start", zap.Any("job", p))
 		if _, err := workers.Enqueue(p.Name, p.Class, p.Args()); err != nil {
-			Log.Error(err.Error(), zap.Any("job", p))
+			p.ex.Log.Error(err.Error(), zap.Any("job", p))
 		}
 	}
 }
@@ -46,22 +49,26 @@ func (p IJob) Run() {
 const cronActiveNodeKey = "active_node:cron"
 
 func (p *IFiberEx) NewJob(jobs ...*IJob) {
+	if JobAlive { // 再設定時は起動中のワーカーを停止してから登録し直す
+		workers.Quit()
+	}
 	workers.Configure(map[string]string{
 		"server":   p.Config.RedisOptions.Addr,
 		"database": fmt.Sprintf("%d", p.Config.JobDatabase),
 		"pool":     fmt.Sprintf("%d", p.Config.JobPool),
 		"process":  fmt.Sprintf("%d", p.Config.JobProcess),
 	})
-	workers.Middleware.Append(&jobInfo{})
+	workers.Middleware.Append(&jobInfo{ex: p})
 	workers.Logger = p
 
 	// cron実行のためのnode登録
-	if err := Redis.Set(context.Background(), cronActiveNodeKey, p.NodeId, time.Duration(0)).Err(); err != nil {
+	if err := p.Redis.Set(context.Background(), cronActiveNodeKey, p.NodeId, time.Duration(0)).Err(); err != nil {
 		p.LogError(err)
 	}
 
 	jobrunner.Start()
 	for _, job := range jobs {
+		job.ex = p
 		workers.Process(job.Name, job.Proc, job.Concurrency, job.Middlewares...)
 		if job.Schedule != nil {
 			if err := jobrunner.Schedule(*job.Schedule, *job); err != nil {
@@ -77,7 +84,7 @@ func (p *IFiberEx) JobRun(jobs ...IJob) {
 		JobAlive = false
 	})
 	JobAlive = true
-	go workers.Run()
+	workers.Start() // シグナルはStartで処理し、停止はShutdownで行う
 }
 
 func (p *IFiberEx) JobEnqueue(queue string, class string, args interface{}) error {
@@ -111,7 +118,7 @@ func (p *IFiberEx) checkCronNode() bool {
 		}
 	}
 	// 次回実行時はアクティブノードを変更する
-	if err := Redis.Set(context.Background(), cronActiveNodeKey, p.NodeId, time.Duration(0)).Err(); err != nil {
+	if err := p.Redis.Set(context.Background(), cronActiveNodeKey, p.NodeId, time.Duration(0)).Err(); err != nil {
 		p.LogError(err)
 	}
 	return false
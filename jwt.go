@@ -0,0 +1,154 @@
+package fiberextend
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+)
+
+type IJwtClaims struct {
+	jwt.RegisteredClaims
+	Type string `json:"typ"` // access or refresh
+}
+
+type IToken struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpireAt     time.Time `json:"expire_at"`
+}
+
+var ErrTokenSecret = errors.New("secret token is not configured")
+
+// 署名に使用する鍵IDと鍵を取得
+func (p *IFiberEx) jwtSigningKey() (string, []byte, error) {
+	if len(p.Config.SecretToken) == 0 {
+		return "", nil, ErrTokenSecret
+	}
+	return p.Config.SecretTokenId, []byte(p.Config.SecretToken), nil
+}
+
+// 鍵IDから検証用の鍵を取得 ローテーション前の鍵も受け付ける
+func (p *IFiberEx) jwtVerifyKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == p.Config.SecretTokenId && len(p.Config.SecretToken) > 0 {
+		return []byte(p.Config.SecretToken), nil
+	}
+	if secret, ok := p.Config.SecretTokenRotated[kid]; ok {
+		return []byte(secret), nil
+	}
+	return nil, fmt.Errorf("unknown key id: %s", kid)
+}
+
+func (p *IFiberEx) signToken(userid string, typ string, expire time.Duration) (string, time.Time, error) {
+	kid, key, err := p.jwtSigningKey()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	now := time.Now()
+	exp := now.Add(expire)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &IJwtClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    *p.Config.AppName,
+			Subject:   userid,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(exp),
+		},
+		Type: typ,
+	})
+	token.Header["kid"] = kid
+	rs, err := token.SignedString(key)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return rs, exp, nil
+}
+
+// アクセストークンとリフレッシュトークンを発行
+func (p *IFiberEx) IssueToken(userid string) (*IToken, error) {
+	access, exp, err := p.signToken(userid, TokenTypeAccess, p.Config.TokenExpireAt)
+	if err != nil {
+		return nil, err
+	}
+	refresh, _, err := p.signToken(userid, TokenTypeRefresh, p.Config.RefreshExpireAt)
+	if err != nil {
+		return nil, err
+	}
+	return &IToken{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		ExpireAt:     exp,
+	}, nil
+}
+
+// トークンを検証してクレームを取得
+func (p *IFiberEx) VerifyToken(src string, typ string) (*IJwtClaims, error) {
+	claims := &IJwtClaims{}
+	_, err := jwt.ParseWithClaims(src, claims, p.jwtVerifyKey,
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(*p.Config.AppName),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Type != typ {
+		return nil, fmt.Errorf("invalid token type: %s", claims.Type)
+	}
+	return claims, nil
+}
+
+// リフレッシュトークンからトークンを再発行
+func (p *IFiberEx) RefreshToken(src string) (*IToken, error) {
+	claims, err := p.VerifyToken(src, TokenTypeRefresh)
+	if err != nil {
+		return nil, err
+	}
+	return p.IssueToken(claims.Subject)
+}
+
+// Authorizationヘッダのトークンを検証してuseridを設定する トークンがない場合は何もしない
+func (p *IFiberEx) JwtMiddleware() func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		auth := c.Get(fiber.HeaderAuthorization)
+		if len(auth) == 0 {
+			return c.Next()
+		}
+		if !strings.HasPrefix(auth, "Bearer ") {
+			return p.ResultAppError(c, E40101.Wrap(fmt.Errorf("invalid authorization header")))
+		}
+		claims, err := p.VerifyToken(strings.TrimPrefix(auth, "Bearer "), TokenTypeAccess)
+		if err != nil {
+			return p.ResultAppError(c, E40101.Wrap(err))
+		}
+		c.Locals("userid", claims.Subject)
+		c.Locals("claims", claims)
+		return c.Next()
+	}
+}
+
+// 認証済みでない場合は401を返す ルート単位で使用する
+func (p *IFiberEx) JwtRequired() func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		if _, ok := c.Locals("claims").(*IJwtClaims); !ok {
+			return p.ResultAppError(c, E40101.Wrap(fmt.Errorf("unauthorized")))
+		}
+		return c.Next()
+	}
+}
+
+// リクエストのクレームを取得
+func GetClaims(c *fiber.Ctx) *IJwtClaims {
+	if claims, ok := c.Locals("claims").(*IJwtClaims); ok {
+		return claims
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package fiberextend_test
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	ext "github.com/h-nosaka/fiberextend"
+)
+
+func TestJwt(t *testing.T) {
+	test := ext.NewTest(t, ext.IFiberExConfig{
+		DevMode:     ext.Bool(true),
+		UseJwt:      true,
+		SecretToken: "new-secret",
+		SecretTokenRotated: map[string]string{
+			"old": "old-secret",
+		},
+	})
+	test.Routes(func(ex *ext.IFiberEx) {
+		ex.App.Get("/me", ex.JwtRequired(), func(c *fiber.Ctx) error {
+			return ex.Result(c, 200, map[string]interface{}{"userid": c.Locals("userid")})
+		})
+	})
+	token, err := test.Ex.IssueToken("user1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.Run("access", func() {
+		test.Api("valid token", &ext.ITestRequest{
+			Method:  "GET",
+			Path:    "/me",
+			Headers: map[string]string{"Authorization": "Bearer " + token.AccessToken},
+		}, 200, &ext.ITestCase{Path: "result.userid", Want: "user1"})
+		test.Api("no token", &ext.ITestRequest{Method: "GET", Path: "/me"}, 401,
+			&ext.ITestCase{Path: "error.0.code", Want: "E40101"})
+		test.Api("refresh token is not access token", &ext.ITestRequest{
+			Method:  "GET",
+			Path:    "/me",
+			Headers: map[string]string{"Authorization": "Bearer " + token.RefreshToken},
+		}, 401)
+	})
+	test.Run("refresh", func() {
+		rs, err := test.Ex.RefreshToken(token.RefreshToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+		claims, err := test.Ex.VerifyToken(rs.AccessToken, ext.TokenTypeAccess)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if claims.Subject != "user1" {
+			t.Errorf("subject: %s", claims.Subject)
+		}
+	})
+	test.Run("rotation", func() {
+		old := ext.New(ext.IFiberExConfig{SecretToken: "old-secret", SecretTokenId: "old"})
+		rs, err := old.IssueToken("user2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := test.Ex.VerifyToken(rs.AccessToken, ext.TokenTypeAccess); err != nil {
+			t.Error(err)
+		}
+		unknown := ext.New(ext.IFiberExConfig{SecretToken: "other-secret", SecretTokenId: "other"})
+		rs, err = unknown.IssueToken("user3")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := test.Ex.VerifyToken(rs.AccessToken, ext.TokenTypeAccess); err == nil {
+			t.Error("unknown key id must be rejected")
+		}
+	})
+}
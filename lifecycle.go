@@ -0,0 +1,135 @@
+package fiberextend
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/bamzi/jobrunner"
+	"github.com/jrallison/go-workers"
+	"go.uber.org/zap"
+)
+
+// サーバを起動し、SIGTERM/SIGINTを受けたらShutdownする
+func (p *IFiberEx) Start(addr string) error {
+	if p.App == nil {
+		p.NewApp()
+	}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- p.App.Listen(addr)
+	}()
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sig)
+	select {
+	case err := <-errs:
+		return err
+	case s := <-sig:
+		p.LogInfo("fiberextend.Start: signal received", zap.String("signal", s.String()))
+	}
+	return p.Shutdown(p.Config.ShutdownTimeout)
+}
+
+// シャットダウン中かどうか
+func (p *IFiberEx) IsShuttingDown() bool {
+	return p.closing.Load()
+}
+
+// HTTP、ジョブ、cron、各接続を順に停止する timeoutを過ぎた処理は待たずに次へ進む
+func (p *IFiberEx) Shutdown(timeout time.Duration) error {
+	if !p.closing.CompareAndSwap(false, true) {
+		return nil // 停止処理は一度だけ実行する
+	}
+	ctx, cancel := context.WithTimeout(background, timeout)
+	defer cancel()
+	errs := []error{}
+
+	// readinessが落ちたことをロードバランサが検知するまで待つ
+	if p.Config.ShutdownDelay > 0 {
+		select {
+		case <-time.After(p.Config.ShutdownDelay):
+		case <-ctx.Done():
+		}
+	}
+
+	// SSE, WebSocket: 終わらない接続を先に閉じる
+	p.closeStreams()
+	if p.Hub != nil {
+		p.Hub.Close()
+	}
+
+	// HTTP: 新規の受付を停止して処理中のリクエストを待つ
+	if p.App != nil {
+		if err := p.App.ShutdownWithContext(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// cron: 次回以降の実行を止めて実行中のジョブを待つ
+	if jobrunner.MainCron != nil {
+		select {
+		case <-jobrunner.MainCron.Stop().Done():
+		case <-ctx.Done():
+			errs = append(errs, errors.New("cron stop timeout"))
+		}
+	}
+
+	// go-workers: 処理中のジョブを待つ
+	done := make(chan struct{})
+	go func() {
+		workers.Quit()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		errs = append(errs, errors.New("job drain timeout"))
+	}
+
+	// Sentry: 送信待ちのイベントを送る
+	if p.Sentry != nil {
+		wait := time.Second
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) > wait {
+			wait = time.Until(deadline)
+		}
+		p.Sentry.Flush(wait)
+	}
+
+	// 接続の切断
+	if p.Redis != nil {
+		if err := p.Redis.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		if Redis == p.Redis {
+			Redis = nil
+		}
+	}
+	if p.DB != nil {
+		if err := closeReplicas(p.DB); err != nil {
+			errs = append(errs, err)
+		}
+		if db, err := p.DB.DB(); err == nil {
+			if err := db.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if DB == p.DB {
+			DB = nil
+		}
+	}
+	if p.ES != nil && ES == p.ES {
+		ES = nil
+	}
+
+	err := errors.Join(errs...)
+	if err != nil {
+		p.Log.With(p.LogCaller()).Error(err.Error()) // 送信済みのためSentryには送らない
+	} else {
+		p.LogInfo("fiberextend.Shutdown: complete")
+	}
+	return err
+}
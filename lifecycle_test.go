@@ -0,0 +1,33 @@
+package fiberextend_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ext "github.com/h-nosaka/fiberextend"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestShutdown(t *testing.T) {
+	test := ext.NewTest(t, ext.IFiberExConfig{
+		UseRedis:     true,
+		RedisOptions: &redis.Options{},
+	})
+	test.DryJobs("test_shutdown")
+	if test.Ex.IsShuttingDown() {
+		t.Error("must not be shutting down")
+	}
+	if err := test.Ex.Shutdown(5 * time.Second); err != nil {
+		t.Error(err)
+	}
+	if !test.Ex.IsShuttingDown() {
+		t.Error("must be shutting down")
+	}
+	if err := test.Ex.Redis.Ping(context.TODO()).Err(); err == nil {
+		t.Error("redis must be closed")
+	}
+	if err := test.Ex.Shutdown(5 * time.Second); err != nil {
+		t.Error(err)
+	}
+}
@@ -18,23 +18,42 @@ func zapLogger(logger *zap.Logger) func(c *fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
 		start := time.Now().Local()
 		chainErr := c.Next()
-		if chainErr != nil {
-			logger.Error(chainErr.Error(), zap.String("requestid", c.Locals("requestid").(string)))
+		if chainErr != nil { // アクセスログにステータスを反映するためここでエラーハンドラを呼ぶ
+			if err := c.App().ErrorHandler(c, chainErr); err != nil {
+				logger.Error(err.Error(), zap.String("requestid", c.Locals("requestid").(string)))
+				_ = c.SendStatus(500)
+			}
 		}
 		stop := time.Now().Local()
 
 		fields := []zap.Field{
 			zap.Int("pid", os.Getpid()),
-			zap.String("elaps", stop.Sub(start).String()),
 			zap.Any("ip", c.IPs()),
 			zap.String("requestid", c.Locals("requestid").(string)),
 			zap.String("userid", c.Locals("userid").(string)),
 			zap.Int("status", c.Response().StatusCode()),
 			zap.Any("query", c.Queries()),
 			zap.String("body", string(c.Request().Body())),
-			zap.String("response", string(c.Response().Body())),
 		}
-		logger.With(fields...).Info(fmt.Sprintf("Access: %s %s", c.Method(), c.Path()))
+		message := fmt.Sprintf("Access: %s %s", c.Method(), c.Path())
+		if stream, ok := c.Locals("stream").(*iStream); ok && c.Response().IsBodyStream() {
+			// ストリームはボディを読み込まずに書き込み完了時に出力する Withでフィールドの値を確定させておく
+			access := logger.With(fields...)
+			stream.onDone(func(rows int64, err error) {
+				fields := []zap.Field{zap.String("elaps", time.Since(start).String()), zap.Int64("rows", rows)}
+				if err != nil {
+					access.Error(message, append(fields, zap.Error(err))...)
+					return
+				}
+				access.Info(message, fields...)
+			})
+			return nil
+		}
+		fields = append(fields,
+			zap.String("elaps", stop.Sub(start).String()),
+			zap.String("response", string(c.Response().Body())),
+		)
+		logger.With(fields...).Info(message)
 
 		return nil
 	}
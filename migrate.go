@@ -0,0 +1,555 @@
+package fiberextend
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// マイグレーションのコマンド RunCommandで"migrate <command>"として受け取る
+const (
+	CommandMigrate  = "migrate"
+	MigrationUp     = "up"
+	MigrationDown   = "down"
+	MigrationStatus = "status"
+	MigrationRedo   = "redo"
+)
+
+// 複数のpodから同時に実行されないように取得するロックの名前
+var MigrationLockName = "schema_migrations"
+
+// SQLファイル名 <version>_<name>.up.sql / <version>_<name>.down.sql
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// 全インスタンスで共有するマイグレーション initから登録する
+var migrations = &iMigrations{}
+
+// 登録済みのマイグレーション バージョン:マイグレーション
+type iMigrations struct {
+	mutex sync.Mutex
+	items map[int64]*IMigration
+}
+
+func (p *iMigrations) add(item *IMigration) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if _, ok := p.items[item.Version]; ok {
+		return fmt.Errorf("migration %d is already registered", item.Version)
+	}
+	if p.items == nil {
+		p.items = map[int64]*IMigration{}
+	}
+	p.items[item.Version] = item
+	return nil
+}
+
+func (p *iMigrations) addFS(fsys fs.FS, dir string) error {
+	items, err := LoadMigrations(fsys, dir)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		if err := p.add(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// itemsにコピーする 同じバージョンがある場合はエラー
+func (p *iMigrations) copyTo(items map[int64]*IMigration) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for version, item := range p.items {
+		if _, ok := items[version]; ok {
+			return fmt.Errorf("migration %d is already registered", version)
+		}
+		items[version] = item
+	}
+	return nil
+}
+
+// バージョンごとのマイグレーション SQLとGoの関数のどちらかを指定する 両方ある場合はSQL、関数の順に実行する
+type IMigration struct {
+	Version int64 // 実行順 20240101120000 のような日時を推奨
+	Name    string
+	UpSql   string
+	DownSql string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// 適用済みのマイグレーションを記録するテーブル
+type ISchemaMigration struct {
+	Version   int64  `gorm:"primaryKey;autoIncrement:false"`
+	Name      string `gorm:"size:255"`
+	AppliedAt time.Time
+}
+
+func (ISchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// マイグレーションの適用状況
+type IMigrationStatus struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+}
+
+// Goのマイグレーションを全インスタンス共通で登録する initから呼ぶことを想定
+func RegisterMigration(version int64, name string, up func(tx *gorm.DB) error, down func(tx *gorm.DB) error) {
+	if err := migrations.add(&IMigration{Version: version, Name: name, Up: up, Down: down}); err != nil {
+		panic(err)
+	}
+}
+
+// fs.FS(embed.FS等)のdir以下のSQLファイルを全インスタンス共通で登録する
+func RegisterMigrationFS(fsys fs.FS, dir string) error {
+	return migrations.addFS(fsys, dir)
+}
+
+// Goのマイグレーションをこのインスタンスに登録する
+func (p *IFiberEx) RegisterMigration(version int64, name string, up func(tx *gorm.DB) error, down func(tx *gorm.DB) error) error {
+	return p.migrations.add(&IMigration{Version: version, Name: name, Up: up, Down: down})
+}
+
+// fs.FS(embed.FS等)のdir以下のSQLファイルをこのインスタンスに登録する
+func (p *IFiberEx) RegisterMigrationFS(fsys fs.FS, dir string) error {
+	return p.migrations.addFS(fsys, dir)
+}
+
+// dir以下のSQLファイルを読み込む 同じバージョンのupとdownは1件にまとめる
+func LoadMigrations(fsys fs.FS, dir string) ([]*IMigration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	items := map[int64]*IMigration{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+		buf, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		item, ok := items[version]
+		if !ok {
+			item = &IMigration{Version: version, Name: match[2]}
+			items[version] = item
+		} else if item.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has different names: %s, %s", version, item.Name, match[2])
+		}
+		if match[3] == MigrationUp {
+			item.UpSql = string(buf)
+		} else {
+			item.DownSql = string(buf)
+		}
+	}
+	return sortMigrations(items), nil
+}
+
+func sortMigrations(items map[int64]*IMigration) []*IMigration {
+	rs := make([]*IMigration, 0, len(items))
+	for _, item := range items {
+		rs = append(rs, item)
+	}
+	sort.Slice(rs, func(i, j int) bool { return rs[i].Version < rs[j].Version })
+	return rs
+}
+
+// 共通とこのインスタンスに登録済みのマイグレーションとMigrationDirのSQLファイルをバージョン順に返す
+func (p *IFiberEx) Migrations() ([]*IMigration, error) {
+	items := map[int64]*IMigration{}
+	if err := migrations.copyTo(items); err != nil {
+		return nil, err
+	}
+	if err := p.migrations.copyTo(items); err != nil {
+		return nil, err
+	}
+	if dir := *p.Config.MigrationDir; dir != "" {
+		if _, err := os.Stat(dir); err == nil {
+			files, err := LoadMigrations(os.DirFS(dir), ".")
+			if err != nil {
+				return nil, err
+			}
+			for _, item := range files {
+				if _, ok := items[item.Version]; ok {
+					return nil, fmt.Errorf("migration %d is already registered", item.Version)
+				}
+				items[item.Version] = item
+			}
+		}
+	}
+	return sortMigrations(items), nil
+}
+
+// コマンドを実行する up [n], down [n], status, redo
+// nを省略した場合、upは未適用をすべて、downは1件戻す commandの省略はup
+func (p *IFiberEx) Migrate(args ...string) error {
+	command := MigrationUp
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+	steps := 0
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid steps: %s", args[0])
+		}
+		steps = n
+	}
+	switch command {
+	case MigrationUp:
+		return p.MigrateUp(steps)
+	case MigrationDown:
+		if steps == 0 {
+			steps = 1
+		}
+		return p.MigrateDown(steps)
+	case MigrationRedo:
+		return p.MigrateRedo()
+	case MigrationStatus:
+		rs, err := p.MigrateStatus()
+		if err != nil {
+			return err
+		}
+		for _, item := range rs {
+			applied := "pending"
+			if item.Applied {
+				applied = item.AppliedAt.Format(time.RFC3339)
+			}
+			p.LogInfo("migrate status", zap.Int64("version", item.Version), zap.String("name", item.Name), zap.String("applied", applied))
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown migrate command: %s", command)
+}
+
+// 未適用のマイグレーションをsteps件適用する 0はすべて
+func (p *IFiberEx) MigrateUp(steps int) error {
+	return p.withMigrationLock(func() error {
+		items, applied, err := p.migrationState()
+		if err != nil {
+			return err
+		}
+		count := 0
+		for _, item := range items {
+			if steps > 0 && count >= steps {
+				break
+			}
+			if _, ok := applied[item.Version]; ok {
+				continue
+			}
+			if err := p.applyMigration(item, true); err != nil {
+				return err
+			}
+			count++
+		}
+		p.LogInfo("migrate up", zap.Int("count", count))
+		return nil
+	})
+}
+
+// 適用済みのマイグレーションを新しい順にsteps件戻す
+func (p *IFiberEx) MigrateDown(steps int) error {
+	return p.withMigrationLock(func() error {
+		items, applied, err := p.migrationState()
+		if err != nil {
+			return err
+		}
+		count := 0
+		for i := len(items) - 1; i >= 0 && count < steps; i-- {
+			if _, ok := applied[items[i].Version]; !ok {
+				continue
+			}
+			if err := p.applyMigration(items[i], false); err != nil {
+				return err
+			}
+			count++
+		}
+		p.LogInfo("migrate down", zap.Int("count", count))
+		return nil
+	})
+}
+
+// 最後に適用したマイグレーションを戻して再適用する
+func (p *IFiberEx) MigrateRedo() error {
+	return p.withMigrationLock(func() error {
+		items, applied, err := p.migrationState()
+		if err != nil {
+			return err
+		}
+		var last *IMigration
+		for _, item := range items {
+			if _, ok := applied[item.Version]; ok {
+				last = item
+			}
+		}
+		if last == nil {
+			return errors.New("no applied migration")
+		}
+		if err := p.applyMigration(last, false); err != nil {
+			return err
+		}
+		return p.applyMigration(last, true)
+	})
+}
+
+// マイグレーションごとの適用状況を返す 定義がない適用済みのバージョンも含む
+func (p *IFiberEx) MigrateStatus() ([]IMigrationStatus, error) {
+	items, applied, err := p.migrationState()
+	if err != nil {
+		return nil, err
+	}
+	rs := []IMigrationStatus{}
+	for _, item := range items {
+		status := IMigrationStatus{Version: item.Version, Name: item.Name}
+		if row, ok := applied[item.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = &row.AppliedAt
+			delete(applied, item.Version)
+		}
+		rs = append(rs, status)
+	}
+	for _, row := range applied {
+		row := row
+		rs = append(rs, IMigrationStatus{Version: row.Version, Name: row.Name, Applied: true, AppliedAt: &row.AppliedAt})
+	}
+	sort.Slice(rs, func(i, j int) bool { return rs[i].Version < rs[j].Version })
+	return rs, nil
+}
+
+func (p *IFiberEx) migrationState() ([]*IMigration, map[int64]ISchemaMigration, error) {
+	if p.DB == nil {
+		return nil, nil, errors.New("database is not connected")
+	}
+	items, err := p.Migrations()
+	if err != nil {
+		return nil, nil, err
+	}
+	// レプリカの遅延で適用済みを未適用と判定しないようにプライマリで読み込む
+	db := p.Primary()
+	if err := db.AutoMigrate(&ISchemaMigration{}); err != nil {
+		return nil, nil, err
+	}
+	rows := []ISchemaMigration{}
+	if err := db.Order("version").Find(&rows).Error; err != nil {
+		return nil, nil, err
+	}
+	applied := make(map[int64]ISchemaMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return items, applied, nil
+}
+
+// 1件のマイグレーションをトランザクション内で実行し、schema_migrationsを更新する
+// MySQLのDDLは暗黙的にコミットされるため、失敗した場合は手動で戻す必要がある
+func (p *IFiberEx) applyMigration(item *IMigration, up bool) error {
+	script, fn, command := item.UpSql, item.Up, MigrationUp
+	if !up {
+		script, fn, command = item.DownSql, item.Down, MigrationDown
+	}
+	if !up && strings.TrimSpace(script) == "" && fn == nil {
+		return fmt.Errorf("migration %d_%s is irreversible", item.Version, item.Name)
+	}
+	start := time.Now()
+	err := p.DB.Transaction(func(tx *gorm.DB) error {
+		for _, stmt := range SplitSql(script) {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		if fn != nil {
+			if err := fn(tx); err != nil {
+				return err
+			}
+		}
+		if up {
+			return tx.Create(&ISchemaMigration{Version: item.Version, Name: item.Name, AppliedAt: time.Now()}).Error
+		}
+		return tx.Delete(&ISchemaMigration{}, item.Version).Error
+	})
+	if err != nil {
+		return fmt.Errorf("migrate %s %d_%s: %w", command, item.Version, item.Name, err)
+	}
+	p.LogInfo("migrate "+command, zap.Int64("version", item.Version), zap.String("name", item.Name), zap.Duration("elaps", time.Since(start)))
+	return nil
+}
+
+// アドバイザリロックを取得してfnを実行する ロックは専用の接続で保持する
+// MySQLはGET_LOCK、PostgreSQLはpg_advisory_lockを使用する それ以外のDBはロックしない
+func (p *IFiberEx) withMigrationLock(fn func() error) error {
+	if p.DB == nil {
+		return errors.New("database is not connected")
+	}
+	db, err := p.Primary().DB()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(background, p.Config.MigrationLockTimeout)
+	defer cancel()
+	var lock, unlock string
+	var key interface{}
+	switch p.DB.Dialector.Name() {
+	case "mysql":
+		lock, unlock = "SELECT GET_LOCK(?, ?)", "SELECT RELEASE_LOCK(?)"
+		key = MigrationLockName
+	case "postgres":
+		lock, unlock = "SELECT pg_try_advisory_lock($1)", "SELECT pg_advisory_unlock($1)"
+		key = migrationLockKey(MigrationLockName)
+	default:
+		return fn()
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := acquireMigrationLock(ctx, conn, lock, key, p.Config.MigrationLockTimeout); err != nil {
+		return err
+	}
+	defer func() {
+		if _, err := conn.ExecContext(background, unlock, key); err != nil {
+			p.LogError(err)
+		}
+	}()
+	return fn()
+}
+
+func acquireMigrationLock(ctx context.Context, conn *sql.Conn, lock string, key interface{}, timeout time.Duration) error {
+	for {
+		var ok sql.NullBool
+		args := []interface{}{key}
+		if _, isName := key.(string); isName {
+			args = append(args, int(timeout.Seconds())) // GET_LOCKはサーバ側で待つ
+		}
+		if err := conn.QueryRowContext(ctx, lock, args...).Scan(&ok); err != nil {
+			return err
+		}
+		if ok.Valid && ok.Bool {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("migration lock timeout: %w", ctx.Err())
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// pg_advisory_lockのキー 名前のハッシュを使用する
+func migrationLockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+// SQLスクリプトを文ごとに分割する 引用符、コメント、PostgreSQLの$$内の;では分割しない
+func SplitSql(script string) []string {
+	rs := []string{}
+	var buf strings.Builder
+	flush := func() {
+		if stmt := strings.TrimSpace(buf.String()); stmt != "" {
+			rs = append(rs, stmt)
+		}
+		buf.Reset()
+	}
+	for i := 0; i < len(script); i++ {
+		ch := script[i]
+		switch {
+		case ch == '\'' || ch == '"' || ch == '`':
+			end := i + 1
+			for end < len(script) {
+				if script[end] == '\\' && ch != '`' {
+					end += 2
+					continue
+				}
+				if script[end] == ch {
+					break
+				}
+				end++
+			}
+			if end >= len(script) {
+				end = len(script) - 1
+			}
+			buf.WriteString(script[i : end+1])
+			i = end
+		case ch == '-' && strings.HasPrefix(script[i:], "--"):
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				i = len(script)
+			} else {
+				i += end
+				buf.WriteByte('\n')
+			}
+		case ch == '/' && strings.HasPrefix(script[i:], "/*"):
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				i = len(script)
+			} else {
+				i += end + 3
+			}
+		case ch == '$':
+			tag := dollarQuote(script[i:])
+			if tag == "" {
+				buf.WriteByte(ch)
+				continue
+			}
+			end := strings.Index(script[i+len(tag):], tag)
+			if end < 0 {
+				buf.WriteString(script[i:])
+				i = len(script)
+			} else {
+				end += i + len(tag)*2
+				buf.WriteString(script[i:end])
+				i = end - 1
+			}
+		case ch == ';':
+			flush()
+		default:
+			buf.WriteByte(ch)
+		}
+	}
+	flush()
+	return rs
+}
+
+// $$ または $tag$ の開始を返す
+func dollarQuote(src string) string {
+	for i := 1; i < len(src); i++ {
+		ch := src[i]
+		if ch == '$' {
+			return src[:i+1]
+		}
+		if !(ch == '_' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || i > 1 && ch >= '0' && ch <= '9') {
+			return ""
+		}
+	}
+	return ""
+}
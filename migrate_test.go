@@ -0,0 +1,284 @@
+package fiberextend_test
+
+import (
+	"database/sql/driver"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	ext "github.com/h-nosaka/fiberextend"
+	"gorm.io/gorm"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"db/002_add_email.up.sql":      {Data: []byte("ALTER TABLE users ADD email text;")},
+		"db/002_add_email.down.sql":    {Data: []byte("ALTER TABLE users DROP email;")},
+		"db/001_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id int);")},
+		"db/001_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+		"db/README.md":                 {Data: []byte("ignored")},
+	}
+	items, err := ext.LoadMigrations(fsys, "db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[0].Version != 1 || items[1].Version != 2 {
+		t.Fatalf("items: %+v", items)
+	}
+	if items[0].Name != "create_users" || items[0].DownSql != "DROP TABLE users;" {
+		t.Errorf("item: %+v", items[0])
+	}
+
+	fsys["db/002_other.down.sql"] = &fstest.MapFile{Data: []byte("")}
+	if _, err := ext.LoadMigrations(fsys, "db"); err == nil {
+		t.Error("different names must be error")
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "20240101000000_init.up.sql"), []byte("SELECT 1;"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ex := ext.New(ext.IFiberExConfig{DevMode: ext.Bool(true), TestMode: ext.Bool(true), MigrationDir: ext.String(dir)})
+	if err := ex.RegisterMigration(20240102000000, "seed", func(tx *gorm.DB) error { return nil }, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := ex.RegisterMigration(20240102000000, "seed", nil, nil); err == nil {
+		t.Error("duplicate version must be error")
+	}
+	items, err := ex.Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[0].Name != "init" || items[1].Name != "seed" || items[1].Up == nil {
+		t.Fatalf("items: %+v", items)
+	}
+	if err := ex.Migrate("status"); err == nil {
+		t.Error("no database must be error")
+	}
+	if err := ex.Migrate("up", "x"); err == nil {
+		t.Error("invalid steps must be error")
+	}
+}
+
+// schema_migrationsを保持する接続 GET_LOCKはlockedの間は取得できない
+type migrationDB struct {
+	*queryPool
+	applied map[int64]string
+	locked  bool
+}
+
+func newMigrationDB(t *testing.T) (*migrationDB, *gorm.DB) {
+	rs := &migrationDB{applied: map[int64]string{}}
+	rs.queryPool = &queryPool{
+		query: func(query string, args []interface{}) ([]string, [][]driver.Value) {
+			switch {
+			case strings.HasPrefix(query, "SELECT GET_LOCK"):
+				return []string{"lock"}, [][]driver.Value{{int64(ext.BoolToUint(!rs.locked))}}
+			case strings.HasPrefix(query, "SELECT DATABASE()"):
+				return []string{"db"}, [][]driver.Value{{"app"}}
+			case strings.Contains(query, "SCHEMATA"):
+				return []string{"SCHEMA_NAME"}, [][]driver.Value{{"app"}}
+			case strings.Contains(strings.ToLower(query), "information_schema"):
+				return []string{"count"}, [][]driver.Value{{int64(0)}}
+			case strings.HasPrefix(query, "SELECT * FROM `schema_migrations`"):
+				versions := []int64{}
+				for version := range rs.applied {
+					versions = append(versions, version)
+				}
+				sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+				rows := [][]driver.Value{}
+				for _, version := range versions {
+					rows = append(rows, []driver.Value{version, rs.applied[version], time.Now()})
+				}
+				return []string{"version", "name", "applied_at"}, rows
+			}
+			t.Errorf("unexpected query: %s", query)
+			return []string{}, nil
+		},
+		exec: func(query string, args []interface{}) error {
+			switch {
+			case strings.HasPrefix(query, "INSERT INTO `schema_migrations`"):
+				rs.applied[args[0].(int64)] = args[1].(string)
+			case strings.HasPrefix(query, "DELETE FROM `schema_migrations`"):
+				delete(rs.applied, args[0].(int64))
+			}
+			return nil
+		},
+	}
+	return rs, newQueryDB(t, rs.queryPool)
+}
+
+// BEGIN等を除いたマイグレーションのSQL
+func (p *migrationDB) statements() []string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	rs := []string{}
+	for _, query := range p.queries {
+		if strings.HasPrefix(query, "CREATE TABLE") || strings.HasPrefix(query, "ALTER TABLE") || strings.HasPrefix(query, "DROP TABLE") {
+			if !strings.Contains(query, "schema_migrations") {
+				rs = append(rs, query)
+			}
+		}
+	}
+	p.queries = nil
+	return rs
+}
+
+func TestMigrate(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"001_create_users.up.sql":   "CREATE TABLE users (id int);",
+		"001_create_users.down.sql": "DROP TABLE users;",
+		"002_add_email.up.sql":      "ALTER TABLE users ADD email text;",
+		"002_add_email.down.sql":    "ALTER TABLE users DROP email;",
+	}
+	for name, body := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ex := ext.New(ext.IFiberExConfig{DevMode: ext.Bool(true), TestMode: ext.Bool(true), MigrationDir: ext.String(dir), MigrationLockTimeout: 100 * time.Millisecond})
+	mdb, db := newMigrationDB(t)
+	ex.DB = db
+	seeded := 0
+	if err := ex.RegisterMigration(3, "seed", func(tx *gorm.DB) error { seeded++; return nil }, nil); err != nil {
+		t.Fatal(err)
+	}
+	status := func(message string, want ...bool) {
+		t.Helper()
+		rs, err := ex.MigrateStatus()
+		if err != nil {
+			t.Fatal(err)
+		}
+		applied := []bool{}
+		for _, item := range rs {
+			applied = append(applied, item.Applied)
+		}
+		if !reflect.DeepEqual(applied, want) {
+			t.Errorf("%s: %+v", message, rs)
+		}
+	}
+
+	if err := ex.Migrate("up", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if rs := mdb.statements(); !reflect.DeepEqual(rs, []string{"CREATE TABLE users (id int)"}) {
+		t.Errorf("up 1: %v", rs)
+	}
+	status("up 1", true, false, false)
+
+	if err := ex.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if rs := mdb.statements(); !reflect.DeepEqual(rs, []string{"ALTER TABLE users ADD email text"}) || seeded != 1 {
+		t.Errorf("up: %v, seeded: %d", rs, seeded)
+	}
+	status("up", true, true, true)
+
+	if err := ex.Migrate("down"); err == nil {
+		t.Error("irreversible migration must be error")
+	}
+	status("irreversible", true, true, true)
+	delete(mdb.applied, 3)
+	if err := ex.Migrate("down", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if rs := mdb.statements(); !reflect.DeepEqual(rs, []string{"ALTER TABLE users DROP email", "DROP TABLE users"}) {
+		t.Errorf("down 2: %v", rs)
+	}
+	status("down 2", false, false, false)
+
+	if err := ex.Migrate("up", "1"); err != nil {
+		t.Fatal(err)
+	}
+	mdb.statements()
+	if err := ex.Migrate("redo"); err != nil {
+		t.Fatal(err)
+	}
+	if rs := mdb.statements(); !reflect.DeepEqual(rs, []string{"DROP TABLE users", "CREATE TABLE users (id int)"}) {
+		t.Errorf("redo: %v", rs)
+	}
+	status("redo", true, false, false)
+	if err := ex.Migrate("status"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMigrateLock(t *testing.T) {
+	ex := ext.New(ext.IFiberExConfig{DevMode: ext.Bool(true), TestMode: ext.Bool(true), MigrationLockTimeout: 100 * time.Millisecond})
+	mdb, db := newMigrationDB(t)
+	ex.DB = db
+	if err := ex.RegisterMigration(1, "create", func(tx *gorm.DB) error { return tx.Exec("CREATE TABLE users (id int)").Error }, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := ex.Migrate("up"); err != nil {
+		t.Fatal(err)
+	}
+	queries := mdb.queries
+	if !strings.HasPrefix(queries[0], "SELECT GET_LOCK") || !strings.HasPrefix(queries[len(queries)-1], "SELECT RELEASE_LOCK") {
+		t.Errorf("migration must run in lock: %v", queries)
+	}
+
+	// 他のpodが実行中
+	delete(mdb.applied, 1)
+	mdb.locked = true
+	mdb.statements()
+	if err := ex.Migrate("up"); err == nil {
+		t.Error("lock timeout must be error")
+	}
+	if rs := mdb.statements(); len(rs) > 0 || len(mdb.applied) > 0 {
+		t.Errorf("migration must not run without lock: %v", rs)
+	}
+}
+
+func TestRunCommandMigrate(t *testing.T) {
+	args := os.Args
+	defer func() { os.Args = args }()
+	ex := ext.New(ext.IFiberExConfig{DevMode: ext.Bool(true), TestMode: ext.Bool(true)})
+	mdb, db := newMigrationDB(t)
+	ex.DB = db
+	if err := ex.RegisterMigration(1, "create", func(tx *gorm.DB) error { return nil }, nil); err != nil {
+		t.Fatal(err)
+	}
+	os.Args = []string{"app", "migrate", "up"}
+	name, rs, ok, err := ex.RunCommand()
+	if err != nil || !ok || name != ext.CommandMigrate || !reflect.DeepEqual(rs, []string{"up"}) {
+		t.Fatalf("name: %s, args: %v, ok: %v, err: %v", name, rs, ok, err)
+	}
+	if _, ok := mdb.applied[1]; !ok {
+		t.Error("migrate command must apply migrations")
+	}
+	os.Args = []string{"app", "run", "job"}
+	if name, _, ok, err := ex.RunCommand(); name != "job" || !ok || err != nil {
+		t.Errorf("run: %s, %v, %v", name, ok, err)
+	}
+}
+
+func TestSplitSql(t *testing.T) {
+	script := `
+-- users; comment
+CREATE TABLE users (id int, name varchar(10) DEFAULT 'a;b');
+/* block; comment */
+INSERT INTO users VALUES (1, 'it''s; ok');
+CREATE FUNCTION f() RETURNS trigger AS $body$
+BEGIN
+  RETURN NEW;
+END;
+$body$ LANGUAGE plpgsql;
+`
+	want := []string{
+		"CREATE TABLE users (id int, name varchar(10) DEFAULT 'a;b')",
+		"INSERT INTO users VALUES (1, 'it''s; ok')",
+		"CREATE FUNCTION f() RETURNS trigger AS $body$\nBEGIN\n  RETURN NEW;\nEND;\n$body$ LANGUAGE plpgsql",
+	}
+	if rs := ext.SplitSql(script); !reflect.DeepEqual(rs, want) {
+		t.Errorf("got %q", rs)
+	}
+}
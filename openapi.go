@@ -0,0 +1,540 @@
+package fiberextend
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ルートの説明 Docで登録する
+type IRouteDoc struct {
+	Summary     string
+	Description string
+	Tags        []string
+	Request     interface{} // リクエストの構造体 GETはクエリ、それ以外はボディ
+	Response    interface{} // resultの型
+	Results     bool        // resultsで一覧を返す
+	Paging      bool        // page, perのクエリを受け付ける
+	Errors      []ErrorCode // 返す可能性のあるエラーコード
+}
+
+type IOpenAPI struct {
+	OpenAPI    string                                   `json:"openapi"`
+	Info       IOpenAPIInfo                             `json:"info"`
+	Servers    []IOpenAPIServer                         `json:"servers,omitempty"`
+	Paths      map[string]map[string]*IOpenAPIOperation `json:"paths"`
+	Components IOpenAPIComponents                       `json:"components"`
+}
+
+type IOpenAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type IOpenAPIServer struct {
+	Url string `json:"url"`
+}
+
+type IOpenAPIComponents struct {
+	Schemas map[string]*ISchema `json:"schemas"`
+}
+
+type IOpenAPIOperation struct {
+	Summary     string                       `json:"summary,omitempty"`
+	Description string                       `json:"description,omitempty"`
+	Tags        []string                     `json:"tags,omitempty"`
+	OperationId string                       `json:"operationId"`
+	Parameters  []*IOpenAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *IOpenAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*IOpenAPIResponse `json:"responses"`
+}
+
+type IOpenAPIParameter struct {
+	Name     string   `json:"name"`
+	In       string   `json:"in"` // path, query or header
+	Required bool     `json:"required,omitempty"`
+	Schema   *ISchema `json:"schema"`
+}
+
+type IOpenAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]*IOpenAPIContent `json:"content"`
+}
+
+type IOpenAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]*IOpenAPIContent `json:"content,omitempty"`
+}
+
+type IOpenAPIContent struct {
+	Schema *ISchema `json:"schema"`
+}
+
+type ISchema struct {
+	Ref                  string              `json:"$ref,omitempty"`
+	Type                 string              `json:"type,omitempty"`
+	Format               string              `json:"format,omitempty"`
+	Description          string              `json:"description,omitempty"`
+	Pattern              string              `json:"pattern,omitempty"`
+	Enum                 []interface{}       `json:"enum,omitempty"`
+	Nullable             bool                `json:"nullable,omitempty"`
+	MinLength            *int64              `json:"minLength,omitempty"`
+	MaxLength            *int64              `json:"maxLength,omitempty"`
+	Minimum              *float64            `json:"minimum,omitempty"`
+	Maximum              *float64            `json:"maximum,omitempty"`
+	MinItems             *int64              `json:"minItems,omitempty"`
+	MaxItems             *int64              `json:"maxItems,omitempty"`
+	Items                *ISchema            `json:"items,omitempty"`
+	Properties           map[string]*ISchema `json:"properties,omitempty"`
+	AdditionalProperties *ISchema            `json:"additionalProperties,omitempty"`
+	Required             []string            `json:"required,omitempty"`
+}
+
+// ドキュメントに含めないルート
+var openAPIIgnorePaths = []string{"/docs", "/swagger"}
+
+func routeDocKey(method string, path string) string {
+	return method + " " + path
+}
+
+// ルートの説明を登録する pathはルート登録時と同じ表記にする
+// 型を省略した場合はHandleRouteで記録済みの型を引き継ぐ
+func (p *IFiberEx) Doc(method string, path string, doc IRouteDoc) {
+	key := routeDocKey(method, path)
+	if src, ok := p.docs.Load(key); ok {
+		if doc.Request == nil {
+			doc.Request = src.(*IRouteDoc).Request
+		}
+		if doc.Response == nil {
+			doc.Response, doc.Results = src.(*IRouteDoc).Response, src.(*IRouteDoc).Results
+		}
+	}
+	p.docs.Store(key, &doc)
+}
+
+// ルート登録時にリクエストとレスポンスの型を記録する Docで登録済みの型は上書きしない
+func (p *IFiberEx) docTypes(method string, path string, types IRouteDoc) {
+	key := routeDocKey(method, path)
+	doc := IRouteDoc{}
+	if src, ok := p.docs.Load(key); ok {
+		doc = *src.(*IRouteDoc)
+	}
+	if doc.Request == nil {
+		doc.Request = types.Request
+	}
+	if doc.Response == nil {
+		doc.Response, doc.Results = types.Response, types.Results
+	}
+	p.docs.Store(key, &doc)
+}
+
+// routerに登録されるルートのパス fiberのグループと同じ規則で結合する
+func routePath(router fiber.Router, path string) string {
+	group, ok := router.(*fiber.Group)
+	if ok && len(path) == 0 {
+		return group.Prefix
+	}
+	if len(path) == 0 || path[0] != '/' {
+		path = "/" + path
+	}
+	if ok {
+		return strings.TrimRight(group.Prefix, "/") + path
+	}
+	return path
+}
+
+// 説明が未登録のルートにリクエストの型等を記録する RequestParser、Handleから呼ばれる
+// 最初のリクエストまで記録されないため、ルート登録時に記録する場合はHandleRouteかDocを使用する
+// 記録するのは型のみ 渡された値はリクエストの内容で埋められるため保持しない
+func (p *IFiberEx) docRoute(c *fiber.Ctx, doc IRouteDoc) {
+	route := c.Route()
+	key := routeDocKey(route.Method, route.Path)
+	if _, ok := p.docs.Load(key); ok {
+		return
+	}
+	doc.Request, doc.Response = zeroValue(doc.Request), zeroValue(doc.Response)
+	p.docs.LoadOrStore(key, &doc)
+}
+
+// 同じ型の空の値 ポインタはnilのポインタになる
+func zeroValue(src interface{}) interface{} {
+	if src == nil {
+		return nil
+	}
+	return reflect.Zero(reflect.TypeOf(src)).Interface()
+}
+
+// 登録済みのルートからOpenAPI 3の仕様を生成する
+func (p *IFiberEx) OpenAPI() *IOpenAPI {
+	spec := &IOpenAPI{
+		OpenAPI: "3.0.3",
+		Info: IOpenAPIInfo{
+			Title:   *p.Config.AppName,
+			Version: *p.Config.AppVersion,
+		},
+		Paths: map[string]map[string]*IOpenAPIOperation{},
+		Components: IOpenAPIComponents{
+			Schemas: map[string]*ISchema{},
+		},
+	}
+	if len(p.Config.Host) > 0 {
+		spec.Servers = []IOpenAPIServer{{Url: fmt.Sprintf("http://%s", p.Config.Host)}}
+	}
+	gen := &schemaGenerator{schemas: spec.Components.Schemas}
+	gen.schema(reflect.TypeOf(IMeta{}))
+	gen.schema(reflect.TypeOf(IError{}))
+	if p.App == nil {
+		return spec
+	}
+	for _, route := range p.App.GetRoutes(true) {
+		if route.Method == fiber.MethodHead || route.Method == fiber.MethodConnect || route.Method == fiber.MethodTrace || strings.ContainsAny(route.Path, "*+") {
+			continue
+		}
+		ignore := false
+		for _, prefix := range openAPIIgnorePaths {
+			if route.Path == prefix || strings.HasPrefix(route.Path, prefix+"/") {
+				ignore = true
+			}
+		}
+		if ignore {
+			continue
+		}
+		doc := &IRouteDoc{}
+		if src, ok := p.docs.Load(routeDocKey(route.Method, route.Path)); ok {
+			doc = src.(*IRouteDoc)
+		}
+		path, params := openAPIPath(route.Path)
+		if spec.Paths[path] == nil {
+			spec.Paths[path] = map[string]*IOpenAPIOperation{}
+		}
+		spec.Paths[path][strings.ToLower(route.Method)] = p.openAPIOperation(gen, route.Method, path, params, doc)
+	}
+	return spec
+}
+
+// :id形式のパスを{id}形式に変換する
+func openAPIPath(path string) (string, []*IOpenAPIParameter) {
+	params := []*IOpenAPIParameter{}
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		if !strings.HasPrefix(part, ":") {
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(part, ":"), "?")
+		parts[i] = "{" + name + "}"
+		params = append(params, &IOpenAPIParameter{Name: name, In: "path", Required: true, Schema: &ISchema{Type: "string"}})
+	}
+	return strings.Join(parts, "/"), params
+}
+
+func (p *IFiberEx) openAPIOperation(gen *schemaGenerator, method string, path string, params []*IOpenAPIParameter, doc *IRouteDoc) *IOpenAPIOperation {
+	op := &IOpenAPIOperation{
+		Summary:     doc.Summary,
+		Description: doc.Description,
+		Tags:        doc.Tags,
+		OperationId: openAPIOperationId(method, path),
+		Parameters:  params,
+		Responses:   map[string]*IOpenAPIResponse{},
+	}
+	if doc.Paging {
+		op.Parameters = append(op.Parameters,
+			&IOpenAPIParameter{Name: "page", In: "query", Schema: &ISchema{Type: "integer", Minimum: Float64(1)}},
+			&IOpenAPIParameter{Name: "per", In: "query", Schema: &ISchema{Type: "integer", Minimum: Float64(1), Maximum: Float64(float64(*p.Config.PagePerMax))}},
+		)
+	}
+	if doc.Request != nil {
+		typ := reflect.TypeOf(doc.Request)
+		binding := newRequestBinding(typ)
+		op.Parameters = append(op.Parameters, gen.parameters(typ, method == fiber.MethodGet)...)
+		if binding.body && method != fiber.MethodGet {
+			op.RequestBody = &IOpenAPIRequestBody{
+				Required: true,
+				Content:  map[string]*IOpenAPIContent{fiber.MIMEApplicationJSON: {Schema: gen.schema(typ)}},
+			}
+		}
+	}
+
+	// 正常時はIResponseで包む
+	body := &ISchema{
+		Type:       "object",
+		Properties: map[string]*ISchema{"meta": {Ref: metaSchemaRef}},
+	}
+	if doc.Response != nil {
+		result := gen.schema(reflect.TypeOf(doc.Response))
+		if doc.Results {
+			body.Properties["results"] = &ISchema{Type: "array", Items: result}
+		} else {
+			body.Properties["result"] = result
+		}
+	}
+	status := "200"
+	if method == fiber.MethodPost {
+		status = "201"
+	}
+	op.Responses[status] = &IOpenAPIResponse{
+		Description: http.StatusText(Atoi(status)),
+		Content:     map[string]*IOpenAPIContent{fiber.MIMEApplicationJSON: {Schema: body}},
+	}
+
+	// エラー時はステータスごとにコードを列挙する
+	errors := map[int][]string{}
+	if doc.Request != nil {
+		errors[400] = append(errors[400], string(E40001))
+	}
+	for _, code := range doc.Errors {
+		errors[code.Status()] = append(errors[code.Status()], fmt.Sprintf("%s: %s", code, code.Message(nil)))
+	}
+	for code, items := range errors {
+		op.Responses[strconv.Itoa(code)] = &IOpenAPIResponse{
+			Description: strings.Join(items, ", "),
+			Content:     map[string]*IOpenAPIContent{fiber.MIMEApplicationJSON: {Schema: openAPIErrorSchema()}},
+		}
+	}
+	op.Responses["default"] = &IOpenAPIResponse{
+		Description: "Error",
+		Content:     map[string]*IOpenAPIContent{fiber.MIMEApplicationJSON: {Schema: openAPIErrorSchema()}},
+	}
+	return op
+}
+
+func openAPIErrorSchema() *ISchema {
+	return &ISchema{
+		Type: "object",
+		Properties: map[string]*ISchema{
+			"meta":  {Ref: metaSchemaRef},
+			"error": {Type: "array", Items: &ISchema{Ref: errorSchemaRef}},
+		},
+	}
+}
+
+// GET /users/{id} -> getUsersId
+func openAPIOperationId(method string, path string) string {
+	rs := strings.ToLower(method)
+	for _, part := range regexp.MustCompile(`[^0-9A-Za-z]+`).Split(path, -1) {
+		if len(part) > 0 {
+			rs += strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+	return rs
+}
+
+func schemaRef(name string) string {
+	return "#/components/schemas/" + name
+}
+
+var schemaNamePattern = regexp.MustCompile(`[^0-9A-Za-z._-]+`)
+
+// componentsのキー 別パッケージの同名の型を区別するためパッケージパスを含める
+// github.com/foo/bar.User -> github.com.foo.bar.User
+func schemaName(typ reflect.Type) string {
+	name := typ.Name()
+	if pkg := typ.PkgPath(); len(pkg) > 0 {
+		name = pkg + "." + name
+	}
+	return schemaNamePattern.ReplaceAllString(strings.ReplaceAll(name, "/", "."), "_")
+}
+
+var metaSchemaRef = schemaRef(schemaName(reflect.TypeOf(IMeta{})))
+var errorSchemaRef = schemaRef(schemaName(reflect.TypeOf(IError{})))
+
+// Goの型からスキーマを生成する 名前付きの構造体はcomponentsに登録して参照する
+type schemaGenerator struct {
+	schemas map[string]*ISchema
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (p *schemaGenerator) schema(typ reflect.Type) *ISchema {
+	nullable := false
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+		nullable = true
+	}
+	rs := &ISchema{Nullable: nullable}
+	switch {
+	case typ == timeType:
+		rs.Type, rs.Format = "string", "date-time"
+	case typ.Kind() == reflect.Struct:
+		if len(typ.Name()) == 0 {
+			return p.object(typ)
+		}
+		name := schemaName(typ)
+		if _, ok := p.schemas[name]; !ok {
+			p.schemas[name] = &ISchema{} // 再帰する型のために先に登録する
+			p.schemas[name] = p.object(typ)
+		}
+		return &ISchema{Ref: schemaRef(name)}
+	case typ.Kind() == reflect.Slice && typ.Elem().Kind() == reflect.Uint8:
+		rs.Type, rs.Format = "string", "byte"
+	case typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array:
+		rs.Type, rs.Items = "array", p.schema(typ.Elem())
+	case typ.Kind() == reflect.Map:
+		rs.Type, rs.AdditionalProperties = "object", p.schema(typ.Elem())
+	case typ.Kind() == reflect.Bool:
+		rs.Type = "boolean"
+	case typ.Kind() >= reflect.Int && typ.Kind() <= reflect.Uint64:
+		rs.Type = "integer"
+		if typ.Kind() == reflect.Int64 || typ.Kind() == reflect.Uint64 {
+			rs.Format = "int64"
+		}
+	case typ.Kind() == reflect.Float32 || typ.Kind() == reflect.Float64:
+		rs.Type = "number"
+	case typ.Kind() == reflect.String:
+		rs.Type = "string"
+	}
+	return rs
+}
+
+func (p *schemaGenerator) object(typ reflect.Type) *ISchema {
+	rs := &ISchema{Type: "object", Properties: map[string]*ISchema{}}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag := strings.Split(field.Tag.Get("json"), ",")
+		if tag[0] == "-" || !isBodyField(field) {
+			continue
+		}
+		if field.Anonymous && len(tag[0]) == 0 && field.Type.Kind() == reflect.Struct {
+			embed := p.object(field.Type)
+			for name, item := range embed.Properties {
+				rs.Properties[name] = item
+			}
+			rs.Required = append(rs.Required, embed.Required...)
+			continue
+		}
+		name := tag[0]
+		if len(name) == 0 {
+			name = field.Name
+		}
+		schema := p.schema(field.Type)
+		if applyValidateTag(schema, field.Tag.Get("validate")) {
+			rs.Required = append(rs.Required, name)
+		}
+		rs.Properties[name] = schema
+	}
+	sort.Strings(rs.Required)
+	return rs
+}
+
+// クエリ、ヘッダのパラメータ GETはタグのないフィールドもクエリにする(fiberのQueryParserと同じ)
+func (p *schemaGenerator) parameters(typ reflect.Type, query bool) []*IOpenAPIParameter {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	params := []*IOpenAPIParameter{}
+	if typ.Kind() != reflect.Struct {
+		return params
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		in, name := "", ""
+		if tag, ok := field.Tag.Lookup("reqHeader"); ok {
+			in, name = "header", strings.Split(tag, ",")[0]
+		} else if tag, ok := field.Tag.Lookup("query"); ok {
+			in, name = "query", strings.Split(tag, ",")[0]
+		} else if _, ok := field.Tag.Lookup("params"); ok {
+			continue // パスから追加済み
+		} else if query {
+			in, name = "query", strings.Split(field.Tag.Get("json"), ",")[0]
+		} else {
+			continue
+		}
+		if name == "-" {
+			continue
+		}
+		if len(name) == 0 {
+			name = field.Name
+		}
+		schema := p.schema(field.Type)
+		required := applyValidateTag(schema, field.Tag.Get("validate"))
+		params = append(params, &IOpenAPIParameter{Name: name, In: in, Required: required, Schema: schema})
+	}
+	return params
+}
+
+// validateタグを制約に変換する requiredの場合はtrueを返す
+func applyValidateTag(schema *ISchema, tag string) bool {
+	required := false
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "dive": // 以降は要素の制約
+			return required
+		case "required":
+			required = true
+		case "omitempty":
+		case "email":
+			schema.Format = "email"
+		case "url", "uri":
+			schema.Format = "uri"
+		case "uuid", "uuid4":
+			schema.Format = "uuid"
+		case "match":
+			schema.Pattern = param
+		case "password":
+			schema.Format = "password"
+			if len(param) == 0 {
+				param = "10"
+			}
+			schema.MinLength = Int64(int64(Atoi(param)))
+		case "oneof":
+			for _, item := range strings.Fields(param) {
+				schema.Enum = append(schema.Enum, item)
+			}
+		case "min", "gte", "max", "lte", "len":
+			value, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				continue
+			}
+			setSchemaLimit(schema, name, value)
+		}
+	}
+	return required
+}
+
+func setSchemaLimit(schema *ISchema, name string, value float64) {
+	lower := name == "min" || name == "gte" || name == "len"
+	upper := name == "max" || name == "lte" || name == "len"
+	switch schema.Type {
+	case "string":
+		if lower {
+			schema.MinLength = Int64(int64(value))
+		}
+		if upper {
+			schema.MaxLength = Int64(int64(value))
+		}
+	case "array":
+		if lower {
+			schema.MinItems = Int64(int64(value))
+		}
+		if upper {
+			schema.MaxItems = Int64(int64(value))
+		}
+	case "integer", "number":
+		if lower {
+			schema.Minimum = Float64(value)
+		}
+		if upper {
+			schema.Maximum = Float64(value)
+		}
+	}
+}
+
+// 仕様をjsonで返す
+func (p *IFiberEx) OpenAPIHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(p.OpenAPI())
+	}
+}
@@ -0,0 +1,54 @@
+package fiberextend
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type docRouteRequest struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+func TestDocRoute(t *testing.T) {
+	ex := &IFiberEx{App: fiber.New(), Config: IFiberExConfig{}}
+	ex.App.Post("/parser", func(c *fiber.Ctx) error {
+		params := &docRouteRequest{}
+		ex.docRoute(c, IRouteDoc{Request: params})
+		return c.BodyParser(params)
+	})
+	ex.App.Post("/generic", func(c *fiber.Ctx) error {
+		params := docRouteRequest{Name: "foo", Password: "secret"}
+		ex.docRoute(c, IRouteDoc{Request: params, Response: &params})
+		return nil
+	})
+	for _, path := range []string{"/parser", "/generic"} {
+		req := httptest.NewRequest("POST", path, strings.NewReader(`{"name":"foo","password":"secret"}`))
+		req.Header.Set("Content-Type", "application/json")
+		res, err := ex.App.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+	src, ok := ex.docs.Load(routeDocKey("POST", "/parser"))
+	if !ok {
+		t.Fatal("doc of /parser is not recorded")
+	}
+	if params, ok := src.(*IRouteDoc).Request.(*docRouteRequest); !ok || params != nil {
+		t.Errorf("request value must not be kept: %+v", src.(*IRouteDoc).Request)
+	}
+	src, ok = ex.docs.Load(routeDocKey("POST", "/generic"))
+	if !ok {
+		t.Fatal("doc of /generic is not recorded")
+	}
+	if params, ok := src.(*IRouteDoc).Request.(docRouteRequest); !ok || params.Password != "" {
+		t.Errorf("request value must not be kept: %+v", src.(*IRouteDoc).Request)
+	}
+	if params, ok := src.(*IRouteDoc).Response.(*docRouteRequest); !ok || params != nil {
+		t.Errorf("response value must not be kept: %+v", src.(*IRouteDoc).Response)
+	}
+}
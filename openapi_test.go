@@ -0,0 +1,152 @@
+package fiberextend_test
+
+import (
+	htmltemplate "html/template"
+	"testing"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	ext "github.com/h-nosaka/fiberextend"
+)
+
+type openAPIUser struct {
+	Id        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Tags      []string  `json:"tags,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type openAPISearch struct {
+	Keyword string `query:"q" validate:"required,min=2"`
+	Status  string `query:"status" validate:"omitempty,oneof=active deleted"`
+}
+
+func TestOpenAPI(t *testing.T) {
+	test := ext.NewTest(t, ext.IFiberExConfig{DevMode: ext.Bool(true)})
+	test.Routes(func(ex *ext.IFiberEx) {
+		ex.App.Post("/users", func(c *fiber.Ctx) error {
+			params := StructTest{}
+			if !ext.RequestParser(ex, c, &params) {
+				return nil
+			}
+			return ex.Result(c, 201, openAPIUser{Name: params.Name})
+		})
+		ex.App.Get("/users", func(c *fiber.Ctx) error {
+			return ex.Result(c, 200)
+		})
+		ex.Doc("GET", "/users", ext.IRouteDoc{
+			Summary:  "search users",
+			Request:  openAPISearch{},
+			Response: openAPIUser{},
+			Results:  true,
+			Paging:   true,
+		})
+		ex.App.Delete("/users/:id", func(c *fiber.Ctx) error {
+			return ex.Result(c, 200)
+		})
+		ex.Doc("DELETE", "/users/:id", ext.IRouteDoc{Errors: []ext.ErrorCode{ext.E40101}})
+		// 登録時に型を記録する リクエストがなくても仕様に含まれる
+		api := ex.App.Group("/v1")
+		ext.HandleRoute(ex, api, "POST", "/users", func(c *fiber.Ctx, req StructTest) (openAPIUser, error) {
+			return openAPIUser{Name: req.Name}, nil
+		})
+		ex.Doc("POST", "/v1/users", ext.IRouteDoc{Summary: "create user"})
+		ex.Doc("GET", "/templates/html", ext.IRouteDoc{Response: &htmltemplate.Template{}})
+		ex.Doc("GET", "/templates/text", ext.IRouteDoc{Response: &texttemplate.Template{}})
+		ex.App.Get("/templates/html", func(c *fiber.Ctx) error { return ex.Result(c, 200) })
+		ex.App.Get("/templates/text", func(c *fiber.Ctx) error { return ex.Result(c, 200) })
+	})
+
+	test.Run("handle route", func() {
+		spec := test.Ex.OpenAPI()
+		op := spec.Paths["/v1/users"]["post"]
+		if op == nil || op.RequestBody == nil || op.Summary != "create user" {
+			t.Fatalf("post /v1/users: %+v", op)
+		}
+		result := op.Responses["201"].Content["application/json"].Schema.Properties["result"]
+		if result == nil || result.Ref != "#/components/schemas/github.com.h-nosaka.fiberextend_test.openAPIUser" {
+			t.Errorf("result: %+v", result)
+		}
+	})
+	test.Run("same name", func() {
+		spec := test.Ex.OpenAPI()
+		for _, name := range []string{"html.template.Template", "text.template.Template"} {
+			if _, ok := spec.Components.Schemas[name]; !ok {
+				t.Errorf("missing schema: %s", name)
+			}
+		}
+	})
+	test.Run("request parser", func() {
+		// RequestParserを通ったルートはリクエストの型が記録される
+		test.Api("create", &ext.ITestRequest{Method: "POST", Path: "/users", Body: map[string]interface{}{}}, 400)
+		spec := test.Ex.OpenAPI()
+		op := spec.Paths["/users"]["post"]
+		if op == nil || op.RequestBody == nil {
+			t.Fatalf("post /users: %+v", op)
+		}
+		if ref := op.RequestBody.Content["application/json"].Schema.Ref; ref != "#/components/schemas/github.com.h-nosaka.fiberextend_test.StructTest" {
+			t.Errorf("ref: %s", ref)
+		}
+		schema := spec.Components.Schemas["github.com.h-nosaka.fiberextend_test.StructTest"]
+		if len(schema.Required) != 5 {
+			t.Errorf("required: %v", schema.Required)
+		}
+		if rs := schema.Properties["name"].Pattern; rs != "^[a-z]+$" {
+			t.Errorf("pattern: %s", rs)
+		}
+		if rs := schema.Properties["age"]; *rs.Minimum != 18 || *rs.Maximum != 30 {
+			t.Errorf("age: %+v", rs)
+		}
+		if rs := schema.Properties["email"].Format; rs != "email" {
+			t.Errorf("format: %s", rs)
+		}
+		if _, ok := op.Responses["400"]; !ok {
+			t.Errorf("responses: %+v", op.Responses)
+		}
+	})
+	test.Run("doc", func() {
+		spec := test.Ex.OpenAPI()
+		op := spec.Paths["/users"]["get"]
+		if op == nil || op.Summary != "search users" {
+			t.Fatalf("get /users: %+v", op)
+		}
+		names := map[string]*ext.IOpenAPIParameter{}
+		for _, param := range op.Parameters {
+			names[param.Name] = param
+		}
+		if q := names["q"]; q == nil || !q.Required || *q.Schema.MinLength != 2 {
+			t.Errorf("q: %+v", q)
+		}
+		if status := names["status"]; status == nil || len(status.Schema.Enum) != 2 {
+			t.Errorf("status: %+v", status)
+		}
+		if names["page"] == nil || names["per"] == nil {
+			t.Errorf("paging: %+v", names)
+		}
+		results := op.Responses["200"].Content["application/json"].Schema.Properties["results"]
+		if results == nil || results.Items.Ref != "#/components/schemas/github.com.h-nosaka.fiberextend_test.openAPIUser" {
+			t.Errorf("results: %+v", results)
+		}
+		if rs := spec.Components.Schemas["github.com.h-nosaka.fiberextend_test.openAPIUser"].Properties["created_at"].Format; rs != "date-time" {
+			t.Errorf("created_at: %s", rs)
+		}
+
+		op = spec.Paths["/users/{id}"]["delete"]
+		if op == nil || len(op.Parameters) != 1 || op.Parameters[0].In != "path" {
+			t.Fatalf("delete /users/{id}: %+v", op)
+		}
+		if _, ok := op.Responses["401"]; !ok {
+			t.Errorf("responses: %+v", op.Responses)
+		}
+		if _, ok := spec.Paths["/docs/openapi.json"]; ok {
+			t.Error("docs must be excluded")
+		}
+	})
+	test.Run("serve", func() {
+		test.Api("openapi.json", &ext.ITestRequest{Method: "GET", Path: "/docs/openapi.json"}, 200,
+			&ext.ITestCase{Path: "openapi", Want: "3.0.3"},
+			&ext.ITestCase{Path: "info.title", Want: "App"},
+		)
+	})
+}
@@ -0,0 +1,64 @@
+package fiberextend
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// 表示ページを取得 未指定または不正な値の場合は1ページ目
+func (p IRequestPaging) GetPage() int {
+	if p.Page == nil || *p.Page < 1 {
+		return 1
+	}
+	return *p.Page
+}
+
+// 表示数を取得 未指定の場合はdef、maxを超える場合はmaxに丸める
+func (p IRequestPaging) GetPer(def int, max int) int {
+	per := def
+	if p.Per != nil && *p.Per > 0 {
+		per = *p.Per
+	}
+	if max > 0 && per > max {
+		per = max
+	}
+	return per
+}
+
+// 取得開始位置
+func (p IRequestPaging) Offset(per int) int {
+	return (p.GetPage() - 1) * per
+}
+
+// ページング情報をlocalsに設定する NewMetaで参照される
+func SetPaging(c *fiber.Ctx, total int64, per int, page int) {
+	max := 0
+	if per > 0 {
+		max = int((total + int64(per) - 1) / int64(per))
+	}
+	c.Locals("total_count", total)
+	c.Locals("page_max", max)
+	c.Locals("page_current", page)
+}
+
+// 件数の取得とページ単位の取得を行い、ページング情報をlocalsに設定する
+func Paging[T any](ex *IFiberEx, c *fiber.Ctx, query *gorm.DB, params IRequestPaging) ([]T, error) {
+	rs := []T{}
+	if query.Statement.Model == nil {
+		query = query.Model(new(T))
+	}
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return rs, err
+	}
+	per := params.GetPer(*ex.Config.PagePer, *ex.Config.PagePerMax)
+	page := params.GetPage()
+	SetPaging(c, total, per, page)
+	if total == 0 {
+		return rs, nil
+	}
+	if err := query.Session(&gorm.Session{}).Offset(params.Offset(per)).Limit(per).Find(&rs).Error; err != nil {
+		return rs, err
+	}
+	return rs, nil
+}
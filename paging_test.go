@@ -0,0 +1,446 @@
+package fiberextend_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	ext "github.com/h-nosaka/fiberextend"
+	gmysql "gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	glogger "gorm.io/gorm/logger"
+)
+
+// クエリをqueryで、更新をexecで処理する接続 実行したSQLを記録する
+type queryPool struct {
+	mutex   sync.Mutex
+	queries []string
+	query   func(query string, args []interface{}) ([]string, [][]driver.Value)
+	exec    func(query string, args []interface{}) error
+}
+
+func (p *queryPool) record(query string, args []driver.NamedValue) []interface{} {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.queries = append(p.queries, query)
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return values
+}
+
+func (p *queryPool) Connect(ctx context.Context) (driver.Conn, error) {
+	return &queryConn{pool: p}, nil
+}
+
+func (p *queryPool) Driver() driver.Driver {
+	return nil
+}
+
+func (p *queryPool) last() string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if len(p.queries) == 0 {
+		return ""
+	}
+	return p.queries[len(p.queries)-1]
+}
+
+type queryConn struct {
+	pool *queryPool
+}
+
+func (p *queryConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (p *queryConn) Close() error {
+	return nil
+}
+
+func (p *queryConn) Begin() (driver.Tx, error) {
+	p.pool.record("BEGIN", nil)
+	return queryTx{pool: p.pool}, nil
+}
+
+func (p *queryConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	columns, rows := p.pool.query(query, p.pool.record(query, args))
+	return &queryRows{columns: columns, rows: rows}, nil
+}
+
+func (p *queryConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	values := p.pool.record(query, args)
+	if p.pool.exec == nil {
+		return nil, errors.New("not supported")
+	}
+	if err := p.pool.exec(query, values); err != nil {
+		return nil, err
+	}
+	return queryResult{}, nil
+}
+
+type queryResult struct{}
+
+func (queryResult) LastInsertId() (int64, error) { return 0, nil }
+func (queryResult) RowsAffected() (int64, error) { return 1, nil }
+
+type queryTx struct {
+	pool *queryPool
+}
+
+func (p queryTx) Commit() error {
+	p.pool.record("COMMIT", nil)
+	return nil
+}
+
+func (p queryTx) Rollback() error {
+	p.pool.record("ROLLBACK", nil)
+	return nil
+}
+
+type queryRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (p *queryRows) Columns() []string { return p.columns }
+func (p *queryRows) Close() error      { return nil }
+func (p *queryRows) Next(dest []driver.Value) error {
+	if len(p.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, p.rows[0])
+	p.rows = p.rows[1:]
+	return nil
+}
+
+func newQueryDB(t *testing.T, pool *queryPool) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(gmysql.New(gmysql.Config{Conn: sql.OpenDB(pool), SkipInitializeWithVersion: true}), &gorm.Config{
+		DisableAutomaticPing: true,
+		Logger:               glogger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+type pagingItem struct {
+	Id   int64
+	Name string
+}
+
+// id順に並んだn件のテーブル
+func pagingItems(n int) []pagingItem {
+	rs := make([]pagingItem, n)
+	for i := range rs {
+		rs[i] = pagingItem{Id: int64(i + 1), Name: fmt.Sprintf("item%d", i+1)}
+	}
+	return rs
+}
+
+func pagingRows(items []pagingItem) [][]driver.Value {
+	rs := [][]driver.Value{}
+	for _, item := range items {
+		rs = append(rs, []driver.Value{item.Id, item.Name})
+	}
+	return rs
+}
+
+func pagingIds(items []pagingItem) []int64 {
+	rs := []int64{}
+	for _, item := range items {
+		rs = append(rs, item.Id)
+	}
+	return rs
+}
+
+func TestRequestPaging(t *testing.T) {
+	src := ext.IRequestPaging{}
+	if rs := src.GetPage(); rs != 1 {
+		t.Errorf("page: %d", rs)
+	}
+	if rs := src.GetPer(30, 100); rs != 30 {
+		t.Errorf("per: %d", rs)
+	}
+	src = ext.IRequestPaging{Page: ext.Int(3), Per: ext.Int(500)}
+	if rs := src.GetPer(30, 100); rs != 100 {
+		t.Errorf("per: %d", rs)
+	}
+	if rs := src.Offset(20); rs != 40 {
+		t.Errorf("offset: %d", rs)
+	}
+}
+
+func TestPaging(t *testing.T) {
+	items := pagingItems(205)
+	pool := &queryPool{query: func(query string, args []interface{}) ([]string, [][]driver.Value) {
+		if strings.HasPrefix(query, "SELECT count(*)") {
+			return []string{"count"}, [][]driver.Value{{int64(len(items))}}
+		}
+		// LIMIT ? [OFFSET ?]
+		limit, offset := int(args[0].(int64)), 0
+		if len(args) > 1 {
+			offset = int(args[1].(int64))
+		}
+		rs := []pagingItem{}
+		if offset < len(items) {
+			rs = items[offset:]
+		}
+		if len(rs) > limit {
+			rs = rs[:limit]
+		}
+		return []string{"id", "name"}, pagingRows(rs)
+	}}
+	test := ext.NewTest(t, ext.IFiberExConfig{})
+	test.Routes(func(ex *ext.IFiberEx) {
+		ex.DB = newQueryDB(t, pool)
+		ex.App.Get("/items", func(c *fiber.Ctx) error {
+			params := ext.IRequestPaging{}
+			if err := c.QueryParser(&params); err != nil {
+				return err
+			}
+			rs, err := ext.Paging[pagingItem](ex, c, ex.DB, params)
+			if err != nil {
+				return err
+			}
+			return ex.Result(c, 200, map[string]interface{}{"ids": pagingIds(rs)})
+		})
+	})
+	test.Run("paging", func() {
+		test.Api("default", &ext.ITestRequest{Method: "GET", Path: "/items"}, 200, []*ext.ITestCase{
+			{Path: "result.ids", Method: ext.TestMethodLen, Want: 30},
+			{Path: "result.ids.0", Want: int64(1)},
+			{Path: "meta.total", Want: int64(205)},
+			{Path: "meta.page", Want: int64(7)},
+			{Path: "meta.current", Want: int64(1)},
+		}...)
+		if query := pool.last(); query != "SELECT * FROM `paging_items` LIMIT ?" {
+			t.Errorf("query: %s", query)
+		}
+		test.Api("page and per", &ext.ITestRequest{Method: "GET", Path: "/items", Query: &map[string]string{"page": "3", "per": "50"}}, 200, []*ext.ITestCase{
+			{Path: "result.ids", Method: ext.TestMethodLen, Want: 50},
+			{Path: "result.ids.0", Want: int64(101)},
+			{Path: "meta.page", Want: int64(5)},
+			{Path: "meta.current", Want: int64(3)},
+		}...)
+		if query := pool.last(); query != "SELECT * FROM `paging_items` LIMIT ? OFFSET ?" {
+			t.Errorf("query: %s", query)
+		}
+		test.Api("clamp per", &ext.ITestRequest{Method: "GET", Path: "/items", Query: &map[string]string{"per": "500"}}, 200, []*ext.ITestCase{
+			{Path: "result.ids", Method: ext.TestMethodLen, Want: 100},
+			{Path: "meta.page", Want: int64(3)},
+		}...)
+		test.Api("last page", &ext.ITestRequest{Method: "GET", Path: "/items", Query: &map[string]string{"page": "7"}}, 200, []*ext.ITestCase{
+			{Path: "result.ids", Method: ext.TestMethodLen, Want: 25},
+			{Path: "result.ids.0", Want: int64(181)},
+		}...)
+		test.Api("out of range", &ext.ITestRequest{Method: "GET", Path: "/items", Query: &map[string]string{"page": "10"}}, 200, []*ext.ITestCase{
+			{Path: "result.ids", Method: ext.TestMethodLen, Want: 0},
+			{Path: "meta.total", Want: int64(205)},
+			{Path: "meta.current", Want: int64(10)},
+		}...)
+	})
+	test.Run("empty", func() {
+		items = nil
+		before := len(pool.queries)
+		test.Api("no rows", &ext.ITestRequest{Method: "GET", Path: "/items"}, 200, []*ext.ITestCase{
+			{Path: "result.ids", Method: ext.TestMethodLen, Want: 0},
+			{Path: "meta.total", Want: nil}, // 0件はmetaに出力しない,
+		}...)
+		if len(pool.queries) != before+1 {
+			t.Errorf("rows must not be queried when count is 0: %v", pool.queries[before:])
+		}
+	})
+}
+
+func TestSetPaging(t *testing.T) {
+	test := ext.NewTest(t, ext.IFiberExConfig{})
+	test.Routes(func(ex *ext.IFiberEx) {
+		ex.App.Get("/list", func(c *fiber.Ctx) error {
+			ext.SetPaging(c, 61, 30, 2)
+			return ex.Result(c, 200, "foo", "bar")
+		})
+	})
+	test.Run("paging", func() {
+		test.Api("meta", &ext.ITestRequest{Method: "GET", Path: "/list"}, 200, []*ext.ITestCase{
+			{Path: "meta.total", Want: int64(61)},
+			{Path: "meta.page", Want: int64(3)},
+			{Path: "meta.current", Want: int64(2)},
+		}...)
+	})
+}
+
+func TestCursor(t *testing.T) {
+	token, err := ext.EncodeCursor(int64(9007199254740993), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs, err := ext.DecodeCursor(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs.Key != int64(9007199254740993) || !rs.Prev {
+		t.Errorf("cursor: %+v", rs)
+	}
+	if _, err := ext.DecodeCursor("invalid"); err == nil {
+		t.Error("invalid cursor must be rejected")
+	}
+}
+
+func TestCursorPaging(t *testing.T) {
+	// nameは重複あり idで同じnameの行の順を決める
+	items := []pagingItem{{1, "a"}, {2, "a"}, {3, "a"}, {4, "b"}, {5, "b"}, {6, "c"}, {7, "c"}}
+	pool := &queryPool{query: func(query string, args []interface{}) ([]string, [][]driver.Value) {
+		composite := strings.Contains(query, "`name`")
+		less := func(a pagingItem, b pagingItem) bool {
+			if composite && a.Name != b.Name {
+				return a.Name < b.Name
+			}
+			return a.Id < b.Id
+		}
+		limit := int(args[len(args)-1].(int64))
+		var cursor *pagingItem
+		if strings.Contains(query, "WHERE") {
+			if composite {
+				cursor = &pagingItem{Name: args[0].(string), Id: args[1].(int64)}
+			} else {
+				cursor = &pagingItem{Id: args[0].(int64)}
+			}
+		}
+		desc := strings.Contains(query, "DESC")
+		rs := []pagingItem{}
+		for i := range items {
+			item := items[i]
+			if desc {
+				item = items[len(items)-1-i]
+			}
+			if cursor != nil && ((desc && !less(item, *cursor)) || (!desc && !less(*cursor, item))) {
+				continue
+			}
+			rs = append(rs, item)
+		}
+		if len(rs) > limit {
+			rs = rs[:limit]
+		}
+		return []string{"id", "name"}, pagingRows(rs)
+	}}
+	test := ext.NewTest(t, ext.IFiberExConfig{})
+	test.Routes(func(ex *ext.IFiberEx) {
+		ex.DB = newQueryDB(t, pool)
+		ex.App.Get("/items", func(c *fiber.Ctx) error {
+			params := ext.IRequestCursor{}
+			if err := c.QueryParser(&params); err != nil {
+				return err
+			}
+			rs, err := ext.CursorPaging(ex, c, ex.DB.Model(&pagingItem{}), params, "id", func(item pagingItem) interface{} { return item.Id })
+			if err != nil {
+				return ex.ResultError(c, 400, err)
+			}
+			return ex.Result(c, 200, map[string]interface{}{"ids": pagingIds(rs)})
+		})
+		ex.App.Get("/names", func(c *fiber.Ctx) error {
+			params := ext.IRequestCursor{}
+			if err := c.QueryParser(&params); err != nil {
+				return err
+			}
+			rs, err := ext.CursorPaging(ex, c, ex.DB.Model(&pagingItem{}), params, "name,id", func(item pagingItem) interface{} { return []interface{}{item.Name, item.Id} })
+			if err != nil {
+				return ex.ResultError(c, 400, err)
+			}
+			return ex.Result(c, 200, map[string]interface{}{"ids": pagingIds(rs)})
+		})
+	})
+	// idsと前後のカーソルを返す
+	fetch := func(path string, cursor string, per int) ([]int64, string, string) {
+		t.Helper()
+		query := fmt.Sprintf("?per=%d", per)
+		if len(cursor) > 0 {
+			query += "&cursor=" + cursor
+		}
+		res, err := test.Ex.App.Test(httptest.NewRequest("GET", path+query, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body := struct {
+			Meta   ext.IMeta
+			Result struct{ Ids []int64 }
+		}{}
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		return body.Result.Ids, body.Meta.Next, body.Meta.Prev
+	}
+	check := func(message string, ids []int64, want []int64, next string, hasNext bool, prev string, hasPrev bool) {
+		t.Helper()
+		if fmt.Sprint(ids) != fmt.Sprint(want) || (len(next) > 0) != hasNext || (len(prev) > 0) != hasPrev {
+			t.Errorf("%s: ids: %v, next: %q, prev: %q", message, ids, next, prev)
+		}
+	}
+	test.Run("forward and backward", func() {
+		ids, next, prev := fetch("/items", "", 3)
+		check("first", ids, []int64{1, 2, 3}, next, true, prev, false)
+		ids, next, prev = fetch("/items", next, 3)
+		check("second", ids, []int64{4, 5, 6}, next, true, prev, true)
+		if query := pool.last(); query != "SELECT * FROM `paging_items` WHERE `id` > ? ORDER BY `id` LIMIT ?" {
+			t.Errorf("query: %s", query)
+		}
+		ids, next, prev = fetch("/items", next, 3)
+		check("last", ids, []int64{7}, next, false, prev, true)
+		ids, next, prev = fetch("/items", prev, 3)
+		check("back to second", ids, []int64{4, 5, 6}, next, true, prev, true)
+		if query := pool.last(); query != "SELECT * FROM `paging_items` WHERE `id` < ? ORDER BY `id` DESC LIMIT ?" {
+			t.Errorf("query: %s", query)
+		}
+		ids, next, prev = fetch("/items", prev, 3)
+		check("back to first", ids, []int64{1, 2, 3}, next, true, prev, false)
+	})
+	test.Run("tie break", func() {
+		ids, next, prev := fetch("/names", "", 2)
+		check("first", ids, []int64{1, 2}, next, true, prev, false)
+		ids, next, prev = fetch("/names", next, 2)
+		check("across same name", ids, []int64{3, 4}, next, true, prev, true)
+		if query := pool.last(); query != "SELECT * FROM `paging_items` WHERE (`name`,`id`) > (?,?) ORDER BY `name`,`id` LIMIT ?" {
+			t.Errorf("query: %s", query)
+		}
+		ids, _, prev = fetch("/names", prev, 2)
+		check("back", ids, []int64{1, 2}, "", false, prev, false)
+		ids, _, prev = fetch("/names", next, 3)
+		check("per", ids, []int64{5, 6, 7}, "", false, prev, true)
+	})
+	test.Run("invalid cursor", func() {
+		token, err := ext.EncodeCursor(int64(1), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.Api("composite key", &ext.ITestRequest{Method: "GET", Path: "/names", Query: &map[string]string{"cursor": token}}, 400)
+	})
+}
+
+func TestSetCursor(t *testing.T) {
+	test := ext.NewTest(t, ext.IFiberExConfig{})
+	test.Routes(func(ex *ext.IFiberEx) {
+		ex.App.Get("/list", func(c *fiber.Ctx) error {
+			ext.SetCursor(c, "next_token", "")
+			return ex.Result(c, 200, "foo", "bar")
+		})
+	})
+	test.Run("cursor", func() {
+		test.Api("meta", &ext.ITestRequest{Method: "GET", Path: "/list"}, 200, []*ext.ITestCase{
+			{Path: "meta.next", Want: "next_token"},
+			{Path: "meta.prev", Want: nil},
+		}...)
+	})
+}
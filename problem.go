@@ -0,0 +1,57 @@
+package fiberextend
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const MIMEApplicationProblemJSON = "application/problem+json"
+
+// RFC 7807 problem details
+type IProblem struct {
+	Type     string   `json:"type"`
+	Title    string   `json:"title"`
+	Status   int      `json:"status"`
+	Detail   string   `json:"detail,omitempty"`
+	Instance string   `json:"instance,omitempty"` // requestid
+	Errors   []IError `json:"errors,omitempty"`   // 拡張メンバ
+}
+
+// problem+jsonで返すかどうか 設定またはAcceptヘッダで判断する
+func (p *IFiberEx) useProblem(c *fiber.Ctx) bool {
+	if p.Config.UseProblemJson {
+		return true
+	}
+	return strings.Contains(c.Get(fiber.HeaderAccept), MIMEApplicationProblemJSON)
+}
+
+func (p *IFiberEx) NewProblem(c *fiber.Ctx, code int, errors ...IError) *IProblem {
+	rs := &IProblem{
+		Type:   "about:blank",
+		Title:  http.StatusText(code),
+		Status: code,
+		Errors: errors,
+	}
+	if len(errors) > 0 {
+		rs.Detail = errors[0].Message
+		if len(p.Config.ProblemTypeBase) > 0 {
+			rs.Type = p.Config.ProblemTypeBase + errors[0].Code
+		}
+	}
+	if id, ok := c.Locals("requestid").(string); ok {
+		rs.Instance = id
+	}
+	return rs
+}
+
+func (p *IFiberEx) resultProblem(c *fiber.Ctx, code int, errors ...IError) error {
+	rs, err := json.Marshal(p.NewProblem(c, code, errors...))
+	if err != nil {
+		return c.SendStatus(500)
+	}
+	c.Set(fiber.HeaderContentType, MIMEApplicationProblemJSON)
+	return c.Status(code).Send(rs)
+}
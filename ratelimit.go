@@ -0,0 +1,100 @@
+package fiberextend
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+type IRateLimit struct {
+	Name   string                    // ポリシー名 キーのプレフィックスに使用する
+	Max    int                       // 期間内の上限回数
+	Window time.Duration             // 期間
+	Key    func(c *fiber.Ctx) string // 集計キー 未指定の場合はIPアドレス
+}
+
+// スライディングウィンドウで回数を数える 戻り値は{許可, 残り回数, 解除までのミリ秒}
+// 時刻はアプリサーバ間でずれないようにRedisのTIMEを使用する
+var rateLimitScript = redis.NewScript(`
+redis.replicate_commands()
+local key = KEYS[1]
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local window = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+redis.call('ZREMRANGEBYSCORE', key, 0, now - window)
+local count = redis.call('ZCARD', key)
+if count < limit then
+	redis.call('ZADD', key, now, ARGV[3])
+	redis.call('PEXPIRE', key, window)
+	local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+	return {1, limit - count - 1, tonumber(oldest[2]) + window - now}
+end
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+return {0, 0, tonumber(oldest[2]) + window - now}
+`)
+
+// IPアドレス単位
+func RateLimitByIP(c *fiber.Ctx) string {
+	return c.IP()
+}
+
+// ユーザ単位 未認証の場合はIPアドレス単位
+func RateLimitByUser(c *fiber.Ctx) string {
+	if userid, ok := c.Locals("userid").(string); ok && userid != "-" {
+		return "user:" + userid
+	}
+	return "ip:" + c.IP()
+}
+
+// 指定ヘッダの値単位 APIキー等に使用する 値はRedisやログに残らないようにハッシュ化する
+func RateLimitByHeader(name string) func(c *fiber.Ctx) string {
+	return func(c *fiber.Ctx) string {
+		if value := c.Get(name); len(value) > 0 {
+			hash := sha256.Sum256([]byte(value))
+			return "header:" + hex.EncodeToString(hash[:])
+		}
+		return "ip:" + c.IP()
+	}
+}
+
+// ルート単位 全利用者で共有する
+func RateLimitByRoute(c *fiber.Ctx) string {
+	return c.Method() + ":" + c.Route().Path
+}
+
+// Redisで回数を数えて上限を超えた場合は429を返す ルートごとにポリシーを指定できる
+func (p *IFiberEx) RateLimit(policy IRateLimit) func(*fiber.Ctx) error {
+	if policy.Key == nil {
+		policy.Key = RateLimitByIP
+	}
+	if len(policy.Name) == 0 {
+		policy.Name = "default"
+	}
+	window := policy.Window.Milliseconds()
+	return func(c *fiber.Ctx) error {
+		key := fmt.Sprintf("ratelimit:%s:%s", policy.Name, policy.Key(c))
+		rs, err := rateLimitScript.Run(c.UserContext(), p.Redis, []string{key}, window, policy.Max, uuid.NewString()).Int64Slice()
+		if err != nil {
+			// Redis障害時はリクエストを止めない
+			p.LogError(err, p.ApiLogFields(c, zap.String("ratelimit", key))...)
+			return c.Next()
+		}
+		reset := (rs[2] + 999) / 1000 // 秒に切り上げ
+		c.Set("RateLimit-Limit", strconv.Itoa(policy.Max))
+		c.Set("RateLimit-Remaining", strconv.FormatInt(rs[1], 10))
+		c.Set("RateLimit-Reset", strconv.FormatInt(reset, 10))
+		if rs[0] == 0 {
+			c.Set(fiber.HeaderRetryAfter, strconv.FormatInt(reset, 10))
+			return p.ResultAppError(c, E42901.Wrap(fmt.Errorf("rate limit exceeded: %s", key)))
+		}
+		return c.Next()
+	}
+}
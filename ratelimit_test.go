@@ -0,0 +1,64 @@
+package fiberextend_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	ext "github.com/h-nosaka/fiberextend"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRateLimit(t *testing.T) {
+	test := ext.NewTest(t, ext.IFiberExConfig{
+		UseRedis:     true,
+		RedisOptions: &redis.Options{},
+	})
+	test.Routes(func(ex *ext.IFiberEx) {
+		ex.App.Get("/limited", ex.RateLimit(ext.IRateLimit{
+			Name:   "limited",
+			Max:    2,
+			Window: time.Minute,
+			Key:    ext.RateLimitByHeader("X-Api-Key"),
+		}), func(c *fiber.Ctx) error {
+			return ex.Result(c, 200, "ok")
+		})
+	})
+	test.Run("limit", func() {
+		req := &ext.ITestRequest{Method: "GET", Path: "/limited", Headers: map[string]string{"X-Api-Key": "key1"}}
+		test.Api("1st", req, 200)
+		test.Api("2nd", req, 200)
+		test.Api("3rd", req, 429, &ext.ITestCase{Path: "error.0.code", Want: "E42901"})
+		test.Api("other key", &ext.ITestRequest{Method: "GET", Path: "/limited", Headers: map[string]string{"X-Api-Key": "key2"}}, 200)
+	})
+	test.Run("hashed key", func() {
+		req := &ext.ITestRequest{Method: "GET", Path: "/limited", Headers: map[string]string{"X-Api-Key": "secret"}}
+		test.Api("request", req, 200)
+		hash := sha256.Sum256([]byte("secret"))
+		if !test.Redis.Exists("ratelimit:limited:header:" + hex.EncodeToString(hash[:])) {
+			t.Errorf("key must be hashed: %v", test.Redis.Keys())
+		}
+		for _, key := range test.Redis.Keys() {
+			if strings.Contains(key, "secret") {
+				t.Errorf("api key must not be stored: %s", key)
+			}
+		}
+	})
+	test.Run("redis time", func() {
+		// ウィンドウの判定はRedisの時刻で行う
+		test.Redis.SetTime(time.Now())
+		req := &ext.ITestRequest{Method: "GET", Path: "/limited", Headers: map[string]string{"X-Api-Key": "key1"}}
+		test.Api("1st", req, 200)
+		test.Api("2nd", req, 200)
+		test.Api("3rd", req, 429)
+		test.Redis.SetTime(time.Now().Add(2 * time.Minute))
+		test.Api("after window", req, 200)
+	})
+	test.Run("reset", func() {
+		req := &ext.ITestRequest{Method: "GET", Path: "/limited", Headers: map[string]string{"X-Api-Key": "key1"}}
+		test.Api("after flush", req, 200)
+	})
+}
@@ -7,6 +7,14 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
+// 自分のトークンを保持している場合のみロックを解除する 期限切れ後に他のリクエストが取得したロックは消さない
+var unlockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
 func (p *IFiberExConfig) NewRedis() *redis.Client {
 	client := redis.NewClient(p.RedisOptions)
 	if client == nil {
@@ -0,0 +1,155 @@
+package fiberextend
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	glogger "gorm.io/gorm/logger"
+	"gorm.io/plugin/dbresolver"
+)
+
+const replicasPluginName = "fiberextend:replicas"
+
+// レプリカの一覧と状態 dbresolverのPolicyとして正常なレプリカを選択する
+// gormのプラグインとして登録し、DBから取り出して停止する
+type iReplicas struct {
+	primary  gorm.ConnPool
+	items    []*iReplica
+	index    atomic.Uint64
+	logger   glogger.Interface
+	interval time.Duration
+	timeout  time.Duration
+	stop     chan struct{}
+	once     sync.Once
+}
+
+// レプリカの接続 Pingを持たないためgorm.Openで接続しない
+type iReplica struct {
+	addr  string
+	db    *sql.DB
+	alive atomic.Bool
+}
+
+func (p *iReplica) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return p.db.PrepareContext(ctx, query)
+}
+
+func (p *iReplica) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return p.db.ExecContext(ctx, query, args...)
+}
+
+func (p *iReplica) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return p.db.QueryContext(ctx, query, args...)
+}
+
+func (p *iReplica) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return p.db.QueryRowContext(ctx, query, args...)
+}
+
+func (p *iReplica) GetDBConn() (*sql.DB, error) {
+	return p.db, nil
+}
+
+func (p *iReplicas) Name() string {
+	return replicasPluginName
+}
+
+func (p *iReplicas) Initialize(db *gorm.DB) error {
+	return nil
+}
+
+// 正常なレプリカをラウンドロビンで返す 全て停止している場合はプライマリを返す
+func (p *iReplicas) Resolve(pools []gorm.ConnPool) gorm.ConnPool {
+	alive := make([]gorm.ConnPool, 0, len(p.items))
+	for _, item := range p.items {
+		if item.alive.Load() {
+			alive = append(alive, item)
+		}
+	}
+	if len(alive) == 0 {
+		return p.primary
+	}
+	return alive[p.index.Add(1)%uint64(len(alive))]
+}
+
+func (p *iReplicas) monitor() {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.check()
+		}
+	}
+}
+
+// 疎通確認に失敗したレプリカは外し、成功したら戻す
+func (p *iReplicas) check() {
+	for _, item := range p.items {
+		ctx, cancel := context.WithTimeout(background, p.timeout)
+		err := item.db.PingContext(ctx)
+		cancel()
+		alive := err == nil
+		if item.alive.Swap(alive) == alive {
+			continue
+		}
+		if alive {
+			p.logger.Info(background, "db replica is available: %s", item.addr)
+		} else {
+			p.logger.Warn(background, "db replica is evicted: %s: %s", item.addr, err)
+		}
+	}
+}
+
+func (p *iReplicas) close() error {
+	p.once.Do(func() { close(p.stop) })
+	errs := []error{}
+	for _, item := range p.items {
+		if err := item.db.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// DBに登録したレプリカの疎通確認を停止し、接続を閉じる
+func closeReplicas(db *gorm.DB) error {
+	if plugin, ok := db.Config.Plugins[replicasPluginName]; ok {
+		return plugin.(*iReplicas).close()
+	}
+	return nil
+}
+
+// 正常なレプリカのアドレス
+func (p *IFiberEx) Replicas() []string {
+	rs := []string{}
+	if p.DB == nil {
+		return rs
+	}
+	if plugin, ok := p.DB.Config.Plugins[replicasPluginName]; ok {
+		for _, item := range plugin.(*iReplicas).items {
+			if item.alive.Load() {
+				rs = append(rs, item.addr)
+			}
+		}
+	}
+	return rs
+}
+
+// 読み込みもプライマリで行う 書き込み直後に読み込む場合に使用する
+func (p *IFiberEx) Primary() *gorm.DB {
+	return p.DB.Clauses(dbresolver.Write).Session(&gorm.Session{})
+}
+
+// このリクエストの読み込みをプライマリで行う
+func (p *IFiberEx) UsePrimary(c *fiber.Ctx) {
+	c.Locals("db_primary", true)
+}
@@ -0,0 +1,192 @@
+package fiberextend
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	gmysql "gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	glogger "gorm.io/gorm/logger"
+	"gorm.io/plugin/dbresolver"
+)
+
+// クエリ数を数えるだけの接続 downの間はPingに失敗する
+type replicaPool struct {
+	queries atomic.Int64
+	down    atomic.Bool
+}
+
+func (p *replicaPool) Connect(ctx context.Context) (driver.Conn, error) {
+	return &replicaConn{pool: p}, nil
+}
+
+func (p *replicaPool) Driver() driver.Driver {
+	return nil
+}
+
+type replicaConn struct {
+	pool *replicaPool
+}
+
+func (p *replicaConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (p *replicaConn) Close() error {
+	return nil
+}
+
+func (p *replicaConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+func (p *replicaConn) Ping(ctx context.Context) error {
+	if p.pool.down.Load() {
+		return errors.New("down")
+	}
+	return nil
+}
+
+func (p *replicaConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	p.pool.queries.Add(1)
+	return replicaRows{}, nil
+}
+
+type replicaRows struct{}
+
+func (replicaRows) Columns() []string              { return []string{"id"} }
+func (replicaRows) Close() error                   { return nil }
+func (replicaRows) Next(dest []driver.Value) error { return io.EOF }
+
+// プライマリと2台のレプリカを登録したDB
+func newReplicaTestDB(t *testing.T) (*gorm.DB, *iReplicas, *replicaPool, []*replicaPool) {
+	t.Helper()
+	primary := &replicaPool{}
+	db, err := gorm.Open(gmysql.New(gmysql.Config{Conn: sql.OpenDB(primary), SkipInitializeWithVersion: true}), &gorm.Config{
+		DisableAutomaticPing: true,
+		Logger:               glogger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	replicas := &iReplicas{
+		primary:  db.Config.ConnPool,
+		logger:   glogger.Discard,
+		interval: 10 * time.Millisecond,
+		timeout:  time.Second,
+		stop:     make(chan struct{}),
+	}
+	pools := []*replicaPool{{}, {}}
+	dialectors := []gorm.Dialector{}
+	for i, pool := range pools {
+		item := &iReplica{addr: []string{"replica1", "replica2"}[i], db: sql.OpenDB(pool)}
+		item.alive.Store(true)
+		replicas.items = append(replicas.items, item)
+		dialectors = append(dialectors, gmysql.New(gmysql.Config{Conn: item, SkipInitializeWithVersion: true}))
+	}
+	if err := db.Use(dbresolver.Register(dbresolver.Config{Replicas: dialectors, Policy: replicas})); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(replicas); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { replicas.close() })
+	return db, replicas, primary, pools
+}
+
+func TestReplicasResolve(t *testing.T) {
+	_, replicas, _, _ := newReplicaTestDB(t)
+	first := replicas.Resolve(nil)
+	second := replicas.Resolve(nil)
+	if first == second || first != replicas.Resolve(nil) {
+		t.Error("alive replicas must be selected by round robin")
+	}
+	replicas.items[0].alive.Store(false)
+	for i := 0; i < 3; i++ {
+		if rs := replicas.Resolve(nil); rs != replicas.items[1] {
+			t.Errorf("evicted replica must not be selected: %v", rs)
+		}
+	}
+	replicas.items[1].alive.Store(false)
+	if rs := replicas.Resolve(nil); rs != replicas.primary {
+		t.Errorf("primary must be selected when no replica is alive: %v", rs)
+	}
+}
+
+func TestReplicasCheck(t *testing.T) {
+	db, replicas, _, pools := newReplicaTestDB(t)
+	ex := &IFiberEx{DB: db}
+	pools[0].down.Store(true)
+	replicas.check()
+	if rs := ex.Replicas(); len(rs) != 1 || rs[0] != "replica2" {
+		t.Errorf("failed replica must be evicted: %v", rs)
+	}
+	pools[0].down.Store(false)
+	replicas.check()
+	if rs := ex.Replicas(); len(rs) != 2 {
+		t.Errorf("recovered replica must be available: %v", rs)
+	}
+
+	go replicas.monitor()
+	pools[1].down.Store(true)
+	deadline := time.Now().Add(time.Second)
+	for len(ex.Replicas()) != 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if rs := ex.Replicas(); len(rs) != 1 || rs[0] != "replica1" {
+		t.Errorf("monitor must evict failed replica: %v", rs)
+	}
+}
+
+func TestReplicasPrimary(t *testing.T) {
+	db, _, primary, pools := newReplicaTestDB(t)
+	ex := &IFiberEx{DB: db}
+	counts := func(message string, want int64, replica int64) {
+		t.Helper()
+		if rs := pools[0].queries.Load() + pools[1].queries.Load(); primary.queries.Load() != want || rs != replica {
+			t.Errorf("%s: primary: %d, replicas: %d", message, primary.queries.Load(), rs)
+		}
+	}
+	rows := []map[string]interface{}{}
+	if err := ex.DB.Table("users").Find(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	counts("read", 0, 1)
+	if err := ex.Primary().Table("users").Find(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	counts("Primary", 1, 1)
+
+	app := fiber.New()
+	app.All("/users", func(c *fiber.Ctx) error {
+		if c.Query("primary") == "true" {
+			ex.UsePrimary(c)
+		}
+		return ex.RequestDB(c).Table("users").Find(&rows).Error
+	})
+	for _, test := range []struct {
+		method  string
+		path    string
+		primary int64
+		replica int64
+	}{
+		{"GET", "/users", 1, 2},
+		{"GET", "/users?primary=true", 2, 2},
+		{"POST", "/users", 3, 2},
+	} {
+		res, err := app.Test(httptest.NewRequest(test.method, test.path, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		counts(test.method+" "+test.path, test.primary, test.replica)
+	}
+}
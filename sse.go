@@ -0,0 +1,219 @@
+package fiberextend
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// 再送用に保持するイベント数 チャンネルごと
+var SSEStreamMaxLen int64 = 1000
+
+type ISSE struct {
+	Channels  func(c *fiber.Ctx) []string // 購読するチャンネル 未指定の場合はルートパラメータのchannel
+	Heartbeat time.Duration               // 接続維持のコメントを送る間隔
+	Replay    int64                       // Last-Event-ID以降に再送する最大件数
+}
+
+type IEvent struct {
+	Id      string `json:"id"`
+	Channel string `json:"channel"`
+	Event   string `json:"event,omitempty"`
+	Data    string `json:"data"`
+}
+
+func sseKey(channel string) string {
+	return "sse:" + channel
+}
+
+// イベントを保存して全ノードに配信する IDはRedis streamのIDを使用する
+func (p *IFiberEx) Publish(channel string, event string, data interface{}) (string, error) {
+	src, ok := data.(string)
+	if !ok {
+		buf, err := json.Marshal(data)
+		if err != nil {
+			return "", err
+		}
+		src = string(buf)
+	}
+	ctx := background
+	id, err := p.Redis.XAdd(ctx, &redis.XAddArgs{
+		Stream: sseKey(channel),
+		MaxLen: SSEStreamMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{"event": event, "data": src},
+	}).Result()
+	if err != nil {
+		return "", err
+	}
+	msg, err := json.Marshal(&IEvent{Id: id, Channel: channel, Event: event, Data: src})
+	if err != nil {
+		return "", err
+	}
+	return id, p.Redis.Publish(ctx, sseKey(channel), msg).Err()
+}
+
+// SSEのルートを登録する handlersは認証等のミドルウェアに使用する
+func (p *IFiberEx) SSE(path string, config ISSE, handlers ...fiber.Handler) fiber.Router {
+	return p.App.Get(path, append(handlers, p.SSEHandler(config))...)
+}
+
+func (p *IFiberEx) SSEHandler(config ISSE) fiber.Handler {
+	if config.Channels == nil {
+		config.Channels = func(c *fiber.Ctx) []string {
+			return []string{c.Params("channel")}
+		}
+	}
+	if config.Heartbeat == 0 {
+		config.Heartbeat = 15 * time.Second
+	}
+	if config.Replay == 0 {
+		config.Replay = 100
+	}
+	return func(c *fiber.Ctx) error {
+		if p.IsShuttingDown() {
+			return c.SendStatus(fiber.StatusServiceUnavailable)
+		}
+		channels := []string{}
+		for _, channel := range config.Channels(c) {
+			if len(channel) > 0 {
+				channels = append(channels, utils.CopyString(channel))
+			}
+		}
+		if len(channels) == 0 {
+			return p.ResultError(c, 400, fmt.Errorf("no sse channel"), E40001.LocalizedErrors(p.Lang(c))...)
+		}
+		lastId := utils.CopyString(c.Get("Last-Event-ID", c.Query("last_event_id")))
+		fields := p.ApiLogFields(c, zap.Strings("channels", channels))
+
+		// 再送の前に購読を開始して取りこぼしを防ぐ
+		ctx, cancel := context.WithCancel(background)
+		keys := []string{}
+		for _, channel := range channels {
+			keys = append(keys, sseKey(channel))
+		}
+		pubsub := p.Redis.Subscribe(ctx, keys...)
+		if _, err := pubsub.Receive(ctx); err != nil {
+			pubsub.Close()
+			cancel()
+			return err
+		}
+		id := uuid.NewString()
+		p.streams.Store(id, cancel)
+		stream := &iStream{}
+		c.Locals("stream", stream)
+
+		c.Set(fiber.HeaderContentType, "text/event-stream")
+		c.Set(fiber.HeaderCacheControl, "no-cache")
+		c.Set(fiber.HeaderConnection, "keep-alive")
+		c.Set("X-Accel-Buffering", "no") // nginxのバッファリングを無効にする
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			defer p.streams.Delete(id)
+			defer cancel()
+			defer pubsub.Close()
+			var count int64
+			defer func() {
+				stream.finish(count, nil)
+			}()
+			sent := map[string]string{} // チャンネルごとの送信済みID
+			if len(lastId) > 0 {
+				for _, channel := range channels {
+					msgs, err := p.Redis.XRangeN(ctx, sseKey(channel), "("+lastId, "+", config.Replay).Result()
+					if err != nil {
+						p.LogError(err, fields...)
+						continue
+					}
+					for _, msg := range msgs {
+						event := &IEvent{Id: msg.ID, Channel: channel}
+						event.Event, _ = msg.Values["event"].(string)
+						event.Data, _ = msg.Values["data"].(string)
+						writeEvent(w, event)
+						sent[channel] = msg.ID
+						count++
+					}
+				}
+			}
+			if _, err := fmt.Fprintf(w, "retry: %d\n\n", 3000); err != nil || w.Flush() != nil {
+				return
+			}
+			ticker := time.NewTicker(config.Heartbeat)
+			defer ticker.Stop()
+			messages := pubsub.Channel()
+			for {
+				select {
+				case <-ctx.Done(): // シャットダウン
+					return
+				case <-ticker.C:
+					if _, err := w.WriteString(": heartbeat\n\n"); err != nil {
+						return
+					}
+				case msg, ok := <-messages:
+					if !ok {
+						return
+					}
+					event := &IEvent{}
+					if err := json.Unmarshal([]byte(msg.Payload), event); err != nil {
+						p.LogError(err, fields...)
+						continue
+					}
+					if last, ok := sent[event.Channel]; ok && compareStreamId(event.Id, last) <= 0 {
+						continue // 再送済み
+					}
+					writeEvent(w, event)
+					count++
+				}
+				if err := w.Flush(); err != nil { // 切断
+					return
+				}
+			}
+		})
+		return nil
+	}
+}
+
+func writeEvent(w *bufio.Writer, event *IEvent) {
+	fmt.Fprintf(w, "id: %s\n", event.Id)
+	if len(event.Event) > 0 {
+		fmt.Fprintf(w, "event: %s\n", event.Event)
+	}
+	for _, line := range strings.Split(event.Data, "\n") {
+		fmt.Fprintf(w, "data: %s\n", line)
+	}
+	w.WriteString("\n")
+}
+
+// streamのID(ミリ秒-連番)を比較する
+func compareStreamId(a string, b string) int {
+	var ams, aseq, bms, bseq uint64
+	fmt.Sscanf(a, "%d-%d", &ams, &aseq)
+	fmt.Sscanf(b, "%d-%d", &bms, &bseq)
+	switch {
+	case ams != bms:
+		if ams < bms {
+			return -1
+		}
+		return 1
+	case aseq < bseq:
+		return -1
+	case aseq > bseq:
+		return 1
+	}
+	return 0
+}
+
+// 接続中のSSEを終了する
+func (p *IFiberEx) closeStreams() {
+	p.streams.Range(func(key, value interface{}) bool {
+		value.(context.CancelFunc)()
+		return true
+	})
+}
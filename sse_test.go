@@ -0,0 +1,101 @@
+package fiberextend_test
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	ext "github.com/h-nosaka/fiberextend"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestSSE(t *testing.T) {
+	test := ext.NewTest(t, ext.IFiberExConfig{
+		UseRedis:     true,
+		RedisOptions: &redis.Options{},
+	})
+	test.Routes(func(ex *ext.IFiberEx) {
+		ex.SSE("/events/:channel", ext.ISSE{Heartbeat: 50 * time.Millisecond})
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go test.Ex.App.Listener(ln)
+
+	first, err := test.Ex.Publish("job", "progress", map[string]int{"done": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := test.Ex.Publish("job", "progress", map[string]int{"done": 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest("GET", "http://"+ln.Addr().String()+"/events/job", nil)
+	req.Header.Set("Last-Event-ID", first)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if mime := res.Header.Get("Content-Type"); mime != "text/event-stream" {
+		t.Errorf("content-type: %s", mime)
+	}
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	wait := func(want string) {
+		timeout := time.After(3 * time.Second)
+		for {
+			select {
+			case line, ok := <-lines:
+				if !ok {
+					t.Fatalf("closed before %s", want)
+				}
+				if strings.HasPrefix(line, "data: "+`{"done":1}`) {
+					t.Errorf("event before Last-Event-ID must not be replayed")
+				}
+				if line == want {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("timeout: %s", want)
+			}
+		}
+	}
+
+	test.Run("replay", func() {
+		wait(`data: {"done":2}`)
+	})
+	test.Run("heartbeat", func() {
+		wait(": heartbeat")
+	})
+	test.Run("publish", func() {
+		if _, err := test.Ex.Publish("job", "", "line1\nline2"); err != nil {
+			t.Fatal(err)
+		}
+		wait("data: line1")
+		wait("data: line2")
+	})
+	test.Run("shutdown", func() {
+		done := make(chan error)
+		go func() {
+			done <- test.Ex.Shutdown(3 * time.Second)
+		}()
+		for range lines { // ストリームが閉じられるまで読む
+		}
+		select {
+		case <-done:
+		case <-time.After(3 * time.Second):
+			t.Fatal("shutdown blocked by sse stream")
+		}
+	})
+}
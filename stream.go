@@ -0,0 +1,224 @@
+package fiberextend
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// ストリームで返せる形式 先頭を優先する
+var streamTypes = []string{fiber.MIMEApplicationJSON, MIMEApplicationNDJSON, MIMETextCSV}
+
+// 何件ごとにクライアントへ送信するか
+var StreamFlushSize = 100
+
+// 1件ずつ結果を渡す関数 エラーが返った場合は中断する
+type IStreamYield func(item interface{}) error
+
+// ストリーム書き込み完了時の処理 アクセスログの出力に使用する
+// 書き込みはSetBodyStreamWriterの時点で別goroutineで始まるため、完了と登録のどちらが先でも一度だけ呼ぶ
+type iStream struct {
+	mutex    sync.Mutex
+	done     func(rows int64, err error)
+	finished bool
+	rows     int64
+	err      error
+}
+
+func (p *iStream) finish(rows int64, err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.finished, p.rows, p.err = true, rows, err
+	if p.done != nil {
+		p.done(rows, err)
+	}
+}
+
+func (p *iStream) onDone(done func(rows int64, err error)) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.done = done
+	if p.finished {
+		done(p.rows, p.err)
+	}
+}
+
+// 結果を1件ずつ書き出す producerは別goroutineで実行されるためfiber.Ctxを使用しないこと
+// producerはハンドラが戻った後に実行されるため、Transactionミドルウェアの中では使用できない(500を返す)
+func (p *IFiberEx) StreamResult(c *fiber.Ctx, producer func(yield IStreamYield) error) error {
+	if tx, ok := c.Locals("tx").(*gorm.DB); ok && tx != nil {
+		// 書き込み前にコミットされ、リクエストのトランザクションを使用できない
+		return p.ResultAppError(c, E00500.Wrap(fmt.Errorf("StreamResult: stream cannot be used inside Transaction")))
+	}
+	mime := c.Accepts(streamTypes...)
+	if len(mime) == 0 {
+		mime = fiber.MIMEApplicationJSON
+	}
+	c.Vary(fiber.HeaderAccept)
+	c.Set(fiber.HeaderContentType, mime+"; charset=utf-8")
+	start, _ := c.Locals("start_time").(time.Time)
+	meta := p.NewMeta(c)
+	failure := E00500.LocalizedErrors(p.Lang(c))
+	fields := p.ApiLogFields(c)
+	stream := &iStream{}
+	c.Locals("stream", stream)
+	c.Status(200).Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		var rows int64
+		enc := newStreamEncoder(mime, w)
+		err := enc.begin()
+		if err == nil {
+			err = producer(func(item interface{}) error {
+				if err := enc.write(item); err != nil {
+					return err
+				}
+				rows++
+				if rows%int64(StreamFlushSize) == 0 {
+					return w.Flush() // クライアントが切断した場合はここで中断する
+				}
+				return nil
+			})
+		}
+		meta.Total = rows
+		meta.Elapsed = time.Since(start).String()
+		errors := []IError{}
+		if err != nil {
+			p.LogError(err, append(fields, zap.Int64("rows", rows))...)
+			errors = failure
+		}
+		if e := enc.end(meta, errors); e != nil && err == nil {
+			err = e
+		}
+		if e := w.Flush(); e != nil && err == nil {
+			err = e
+		}
+		stream.finish(rows, err)
+	})
+	return nil
+}
+
+// gormの結果を1行ずつ読み込んで書き出す queryはex.DBから作成すること
+// 読み込みはハンドラが戻った後に行うため、Transactionの中では使用できない(ITransaction.Skipで除外する)
+func Stream[T any](ex *IFiberEx, c *fiber.Ctx, query *gorm.DB) error {
+	if query.Statement.Model == nil {
+		query = query.Model(new(T))
+	}
+	return ex.StreamResult(c, func(yield IStreamYield) error {
+		rows, err := query.Rows()
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var item T
+			if err := query.ScanRows(rows, &item); err != nil {
+				return err
+			}
+			if err := yield(item); err != nil {
+				return err
+			}
+		}
+		return rows.Err()
+	})
+}
+
+// gormの結果をsize件ずつ読み込んで書き出す 主キー順になる Streamと同様にTransactionの中では使用できない
+func StreamInBatches[T any](ex *IFiberEx, c *fiber.Ctx, query *gorm.DB, size int) error {
+	return ex.StreamResult(c, func(yield IStreamYield) error {
+		batch := []T{}
+		return query.FindInBatches(&batch, size, func(tx *gorm.DB, n int) error {
+			for _, item := range batch {
+				if err := yield(item); err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+	})
+}
+
+type streamEncoder struct {
+	mime    string
+	w       *bufio.Writer
+	csv     *csv.Writer
+	columns bool
+	count   int64
+}
+
+func newStreamEncoder(mime string, w *bufio.Writer) *streamEncoder {
+	rs := &streamEncoder{mime: mime, w: w}
+	if mime == MIMETextCSV {
+		rs.csv = csv.NewWriter(w)
+	}
+	return rs
+}
+
+func (p *streamEncoder) begin() error {
+	if p.mime == fiber.MIMEApplicationJSON {
+		_, err := p.w.WriteString(`{"results":[`)
+		return err
+	}
+	return nil
+}
+
+func (p *streamEncoder) write(item interface{}) error {
+	defer func() { p.count++ }()
+	switch p.mime {
+	case MIMETextCSV:
+		header, row := csvRow(item)
+		if !p.columns {
+			p.columns = true
+			if err := p.csv.Write(header); err != nil {
+				return err
+			}
+		}
+		if err := p.csv.Write(row); err != nil {
+			return err
+		}
+		p.csv.Flush()
+		return p.csv.Error()
+	case MIMEApplicationNDJSON:
+		return json.NewEncoder(p.w).Encode(item)
+	}
+	buf, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	if p.count > 0 {
+		if err := p.w.WriteByte(','); err != nil {
+			return err
+		}
+	}
+	_, err = p.w.Write(buf)
+	return err
+}
+
+// metaとerrorを最後に書き出す CSVはエラー行のみ出力する
+func (p *streamEncoder) end(meta *IMeta, errors []IError) error {
+	switch p.mime {
+	case MIMETextCSV:
+		for _, item := range errors {
+			if err := p.write(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case MIMEApplicationNDJSON:
+		return json.NewEncoder(p.w).Encode(&IResponse{Meta: meta, Errors: errors})
+	}
+	buf, err := json.Marshal(&IResponse{Meta: meta, Errors: errors})
+	if err != nil {
+		return err
+	}
+	if _, err := p.w.WriteString(`],`); err != nil {
+		return err
+	}
+	_, err = p.w.Write(buf[1:]) // 先頭の{を除いて連結する
+	return err
+}
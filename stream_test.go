@@ -0,0 +1,128 @@
+package fiberextend_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	ext "github.com/h-nosaka/fiberextend"
+	"gorm.io/gorm"
+)
+
+func TestStreamResult(t *testing.T) {
+	test := ext.NewTest(t, ext.IFiberExConfig{})
+	test.Routes(func(ex *ext.IFiberEx) {
+		ex.App.Get("/export", func(c *fiber.Ctx) error {
+			return ex.StreamResult(c, func(yield ext.IStreamYield) error {
+				for i := 1; i <= 250; i++ {
+					if err := yield(encoderItem{Id: i, Name: fmt.Sprintf("item%d", i)}); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		})
+		ex.App.Get("/broken", func(c *fiber.Ctx) error {
+			return ex.StreamResult(c, func(yield ext.IStreamYield) error {
+				if err := yield(encoderItem{Id: 1, Name: "foo"}); err != nil {
+					return err
+				}
+				return fmt.Errorf("connection lost")
+			})
+		})
+	})
+	get := func(path string, accept string) (int, string, string) {
+		req := httptest.NewRequest("GET", path, nil)
+		if len(accept) > 0 {
+			req.Header.Set(fiber.HeaderAccept, accept)
+		}
+		res, err := test.Ex.App.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.StatusCode, res.Header.Get(fiber.HeaderContentType), string(body)
+	}
+	test.Run("json", func() {
+		status, mime, body := get("/export", "")
+		if status != 200 || mime != "application/json; charset=utf-8" {
+			t.Errorf("status: %d content-type: %s", status, mime)
+		}
+		rs := ext.IResponse{}
+		if err := json.Unmarshal([]byte(body), &rs); err != nil {
+			t.Fatal(err)
+		}
+		if len(rs.Results) != 250 || rs.Meta == nil || rs.Meta.Total != 250 {
+			t.Errorf("results: %d meta: %+v", len(rs.Results), rs.Meta)
+		}
+	})
+	test.Run("ndjson", func() {
+		_, mime, body := get("/export", "application/x-ndjson")
+		if mime != "application/x-ndjson; charset=utf-8" {
+			t.Errorf("content-type: %s", mime)
+		}
+		lines := strings.Split(strings.TrimSpace(body), "\n")
+		if len(lines) != 251 {
+			t.Fatalf("lines: %d", len(lines))
+		}
+		if !strings.HasPrefix(lines[250], `{"meta":{"total":250,`) {
+			t.Errorf("meta: %s", lines[250])
+		}
+	})
+	test.Run("csv", func() {
+		_, mime, body := get("/export", "text/csv")
+		if mime != "text/csv; charset=utf-8" {
+			t.Errorf("content-type: %s", mime)
+		}
+		lines := strings.Split(strings.TrimSpace(body), "\n")
+		if len(lines) != 251 || lines[0] != "id,item_name" || lines[250] != "250,item250" {
+			t.Errorf("lines: %d %s %s", len(lines), lines[0], lines[len(lines)-1])
+		}
+	})
+	test.Run("error", func() {
+		_, _, body := get("/broken", "")
+		rs := ext.IResponse{}
+		if err := json.Unmarshal([]byte(body), &rs); err != nil {
+			t.Fatal(err)
+		}
+		if len(rs.Results) != 1 || len(rs.Errors) != 1 || rs.Errors[0].Code != "E00500" {
+			t.Errorf("body: %s", body)
+		}
+	})
+}
+
+func TestStreamTransaction(t *testing.T) {
+	recorder := &txRecorder{}
+	test := ext.NewTest(t, ext.IFiberExConfig{})
+	test.Routes(func(ex *ext.IFiberEx) {
+		db, err := gorm.Open(txDialector{conn: &txConn{recorder: recorder}}, &gorm.Config{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ex.DB = db
+		ex.App.Get("/export", ex.Transaction(ext.ITransaction{
+			Skip: func(c *fiber.Ctx) bool { return c.Query("skip") == "true" },
+		}), func(c *fiber.Ctx) error {
+			return ex.StreamResult(c, func(yield ext.IStreamYield) error {
+				return yield(encoderItem{Id: 1, Name: "foo"})
+			})
+		})
+	})
+	test.Run("inside transaction", func() {
+		test.Api("stream", &ext.ITestRequest{Method: "GET", Path: "/export"}, 500, &ext.ITestCase{Path: "error.0.code", Want: "E00500"})
+		if recorder.commits != 0 || recorder.rollbacks != 1 {
+			t.Errorf("commits: %d rollbacks: %d", recorder.commits, recorder.rollbacks)
+		}
+	})
+	test.Run("skip", func() {
+		test.Api("stream", &ext.ITestRequest{Method: "GET", Path: "/export", Query: &map[string]string{"skip": "true"}}, 200, &ext.ITestCase{Path: "meta.total", Want: int64(1)})
+	})
+}
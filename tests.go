@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -15,6 +16,7 @@ import (
 
 	miniredis "github.com/alicebob/miniredis/v2"
 	"github.com/bitly/go-simplejson"
+	"github.com/fasthttp/websocket"
 	"github.com/gofiber/fiber/v2"
 	"github.com/jrallison/go-workers"
 	"github.com/redis/go-redis/v9"
@@ -28,6 +30,7 @@ type IFiberExTest struct {
 	App   *fiber.App
 	t     *testing.T
 	Redis *miniredis.Miniredis
+	addr  string // WebSocket用に起動したサーバのアドレス
 }
 
 type ITestMethod int
@@ -68,7 +71,6 @@ func NewTest(t *testing.T, config IFiberExConfig) *IFiberExTest {
 	// redisをminiredisに置き換え
 	var r *miniredis.Miniredis
 	if config.UseRedis {
-		Redis = nil // redisを空にする
 		r = miniredis.RunT(t)
 		if config.RedisOptions == nil {
 			config.RedisOptions = &redis.Options{}
@@ -165,6 +167,10 @@ func (p *IFiberExTest) Api(message string, request *ITestRequest, status int, as
 		if err != nil {
 			p.t.Error(err)
 		}
+		if len(body) == 0 { // 304等のボディがないレスポンス
+			data = simplejson.New()
+			return nil
+		}
 		buf, err := simplejson.NewJson(body)
 		if err != nil {
 			p.t.Error(err)
@@ -188,6 +194,36 @@ func (p *IFiberExTest) Api(message string, request *ITestRequest, status int, as
 	}
 }
 
+// WebSocketで接続する サーバは初回の呼び出し時にランダムなポートで起動する
+func (p *IFiberExTest) WebSocket(path string, headers map[string]string) *websocket.Conn {
+	if len(p.addr) == 0 {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			p.t.Fatal(err)
+		}
+		go p.App.Listener(ln)
+		p.addr = ln.Addr().String()
+		p.t.Cleanup(func() {
+			_ = p.App.Shutdown()
+		})
+	}
+	header := http.Header{}
+	for key, value := range headers {
+		header.Set(key, value)
+	}
+	conn, res, err := websocket.DefaultDialer.Dial(fmt.Sprintf("ws://%s%s", p.addr, path), header)
+	if err != nil {
+		if res != nil {
+			p.t.Fatal(p.it(fmt.Sprintf("websocket: %s", res.Status)), err)
+		}
+		p.t.Fatal(p.it("websocket"), err)
+	}
+	p.t.Cleanup(func() {
+		conn.Close()
+	})
+	return conn
+}
+
 func (p *IFiberExTest) fiberToHandlerFunc() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		resp, err := p.App.Test(r)
@@ -0,0 +1,95 @@
+package fiberextend
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+type ITransaction struct {
+	Options *sql.TxOptions          // 分離レベル等
+	Skip    func(c *fiber.Ctx) bool // trueを返したリクエストはトランザクションを開始しない
+}
+
+// リクエストごとにトランザクションを開始する RequestDBで取得する
+// ステータスが400未満の場合はコミット、400以上、エラー、panicの場合はロールバックする
+// コミット後に書き込むストリームのレスポンスでは使用しないこと
+// DBがトランザクション中(テスト等)の場合はセーブポイントを使用する
+func (p *IFiberEx) Transaction(config ITransaction) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		if config.Skip != nil && config.Skip(c) {
+			return c.Next()
+		}
+		if tx, ok := c.Locals("tx").(*gorm.DB); ok && tx != nil { // 既にトランザクション中
+			return c.Next()
+		}
+		tx, savepoint, err := p.beginRequest(c, config.Options)
+		if err != nil {
+			return p.ResultError(c, 500, err)
+		}
+		c.Locals("tx", tx)
+		done := false
+		defer func() {
+			c.Locals("tx", nil)
+			if !done { // panic
+				p.rollbackRequest(c, tx, savepoint)
+			}
+		}()
+		err = c.Next()
+		done = true
+		if err != nil || c.Response().StatusCode() >= 400 {
+			p.rollbackRequest(c, tx, savepoint)
+			return err
+		}
+		if len(savepoint) > 0 {
+			return nil
+		}
+		if err := tx.Commit().Error; err != nil {
+			return p.ResultError(c, 500, err)
+		}
+		return nil
+	}
+}
+
+func (p *IFiberEx) beginRequest(c *fiber.Ctx, options *sql.TxOptions) (*gorm.DB, string, error) {
+	if p.DB == nil {
+		return nil, "", fmt.Errorf("database is not connected")
+	}
+	db := p.DB.WithContext(c.UserContext())
+	if _, ok := db.Statement.ConnPool.(gorm.TxCommitter); ok {
+		savepoint := fmt.Sprintf("sp%p", c) // リクエストごとに一意な名前
+		return db, savepoint, db.SavePoint(savepoint).Error
+	}
+	tx := db.Begin(options)
+	return tx, "", tx.Error
+}
+
+func (p *IFiberEx) rollbackRequest(c *fiber.Ctx, tx *gorm.DB, savepoint string) {
+	var err error
+	if len(savepoint) > 0 {
+		err = tx.RollbackTo(savepoint).Error
+	} else {
+		err = tx.Rollback().Error
+	}
+	if err != nil {
+		p.LogError(err, p.ApiLogFields(c, zap.String("tx", "rollback"))...)
+	}
+}
+
+// リクエストで使用するDB Transactionの中ではリクエストのトランザクションを返す
+// GET/HEAD以外とUsePrimaryを呼んだリクエストはプライマリで読み込む
+func (p *IFiberEx) RequestDB(c *fiber.Ctx) *gorm.DB {
+	if tx, ok := c.Locals("tx").(*gorm.DB); ok && tx != nil {
+		return tx
+	}
+	db := p.DB.WithContext(c.UserContext())
+	primary, _ := c.Locals("db_primary").(bool)
+	if primary || (c.Method() != fiber.MethodGet && c.Method() != fiber.MethodHead) {
+		return db.Clauses(dbresolver.Write).Session(&gorm.Session{})
+	}
+	return db
+}
@@ -0,0 +1,130 @@
+package fiberextend_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	ext "github.com/h-nosaka/fiberextend"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// コミットとロールバックを記録するだけの接続
+type txRecorder struct {
+	mutex     sync.Mutex
+	commits   int
+	rollbacks int
+}
+
+type txConn struct {
+	recorder *txRecorder
+}
+
+func (p *txConn) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (p *txConn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return nil, errors.New("not supported")
+}
+
+func (p *txConn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return nil, errors.New("not supported")
+}
+
+func (p *txConn) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return nil
+}
+
+func (p *txConn) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	return &txConnTx{txConn: p}, nil
+}
+
+type txConnTx struct {
+	*txConn
+}
+
+func (p *txConnTx) Commit() error {
+	p.recorder.mutex.Lock()
+	defer p.recorder.mutex.Unlock()
+	p.recorder.commits++
+	return nil
+}
+
+func (p *txConnTx) Rollback() error {
+	p.recorder.mutex.Lock()
+	defer p.recorder.mutex.Unlock()
+	p.recorder.rollbacks++
+	return nil
+}
+
+type txDialector struct {
+	conn *txConn
+}
+
+func (p txDialector) Name() string { return "tx" }
+func (p txDialector) Initialize(db *gorm.DB) error {
+	db.ConnPool = p.conn
+	return nil
+}
+func (p txDialector) Migrator(db *gorm.DB) gorm.Migrator                    { return nil }
+func (p txDialector) DataTypeOf(*schema.Field) string                       { return "" }
+func (p txDialector) DefaultValueOf(*schema.Field) clause.Expression        { return nil }
+func (p txDialector) BindVarTo(clause.Writer, *gorm.Statement, interface{}) {}
+func (p txDialector) QuoteTo(writer clause.Writer, str string)              { _, _ = writer.WriteString(str) }
+func (p txDialector) Explain(sql string, vars ...interface{}) string        { return sql }
+
+func TestTransaction(t *testing.T) {
+	recorder := &txRecorder{}
+	test := ext.NewTest(t, ext.IFiberExConfig{})
+	test.Routes(func(ex *ext.IFiberEx) {
+		db, err := gorm.Open(txDialector{conn: &txConn{recorder: recorder}}, &gorm.Config{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ex.DB = db
+		api := ex.App.Group("/tx", ex.Transaction(ext.ITransaction{
+			Skip: func(c *fiber.Ctx) bool { return c.Query("skip") == "true" },
+		}))
+		api.Get("/", func(c *fiber.Ctx) error {
+			_, ok := ex.RequestDB(c).Statement.ConnPool.(*txConnTx)
+			return ex.Result(c, 200, map[string]interface{}{"tx": ok})
+		})
+		api.Post("/invalid", func(c *fiber.Ctx) error {
+			return ex.ResultError(c, 400, errors.New("invalid"))
+		})
+		api.Post("/error", func(c *fiber.Ctx) error {
+			return ext.E40901.Wrap(errors.New("conflict"))
+		})
+		api.Post("/panic", func(c *fiber.Ctx) error {
+			panic("panic")
+		})
+	})
+	count := func(commits, rollbacks int) {
+		t.Helper()
+		recorder.mutex.Lock()
+		defer recorder.mutex.Unlock()
+		if recorder.commits != commits || recorder.rollbacks != rollbacks {
+			t.Errorf("commits: %d, rollbacks: %d", recorder.commits, recorder.rollbacks)
+		}
+	}
+	test.Run("commit", func() {
+		test.Api("request db", &ext.ITestRequest{Method: "GET", Path: "/tx"}, 200, &ext.ITestCase{Path: "result.tx", Want: true})
+		count(1, 0)
+		test.Api("skip", &ext.ITestRequest{Method: "GET", Path: "/tx", Query: &map[string]string{"skip": "true"}}, 200, &ext.ITestCase{Path: "result.tx", Want: false})
+		count(1, 0)
+	})
+	test.Run("rollback", func() {
+		test.Api("status", &ext.ITestRequest{Method: "POST", Path: "/tx/invalid"}, 400)
+		count(1, 1)
+		test.Api("error", &ext.ITestRequest{Method: "POST", Path: "/tx/error"}, 409)
+		count(1, 2)
+		test.Api("panic", &ext.ITestRequest{Method: "POST", Path: "/tx/panic"}, 500)
+		count(1, 3)
+	})
+}
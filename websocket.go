@@ -0,0 +1,352 @@
+package fiberextend
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	WsTypeJoin    = "join"
+	WsTypeLeave   = "leave"
+	WsTypeMessage = "message"
+	WsTypeError   = "error"
+)
+
+var (
+	WsSendBuffer   = 64               // クライアントごとの送信待ち件数 超えた場合は切断する
+	WsPingInterval = 30 * time.Second // pingの間隔 2回分応答がない場合は切断する
+)
+
+type IWsMessage struct {
+	Type   string          `json:"type"`
+	Room   string          `json:"room,omitempty"`
+	UserId string          `json:"userid,omitempty"` // 送信者 サーバで設定する
+	Data   json.RawMessage `json:"data,omitempty"`
+}
+
+type IWsClient struct {
+	Id     string
+	UserId string
+	conn   *websocket.Conn
+	send   chan []byte
+	done   chan struct{}
+	once   sync.Once
+	rooms  map[string]bool
+}
+
+// 接続中のクライアントとルームを管理する Redisがある場合はpub/subで全ノードに配信する
+type IHub struct {
+	ex        *IFiberEx
+	mutex     sync.RWMutex
+	clients   map[*IWsClient]bool
+	rooms     map[string]map[*IWsClient]bool
+	pubsub    *redis.PubSub
+	closed    bool
+	OnJoin    func(client *IWsClient, room string) error     // 参加時の認可 エラーの場合は参加させない
+	OnMessage func(client *IWsClient, msg *IWsMessage) error // 受信時の処理 未指定はルームに配信する
+}
+
+func wsRoomKey(room string) string {
+	return "ws:room:" + room
+}
+
+// ユーザ個別のルーム 接続時に自動で参加する
+func wsUserRoom(userid string) string {
+	return "user:" + userid
+}
+
+func (p *IFiberEx) NewHub() *IHub {
+	hub := &IHub{
+		ex:      p,
+		clients: map[*IWsClient]bool{},
+		rooms:   map[string]map[*IWsClient]bool{},
+	}
+	if p.Redis != nil {
+		pubsub := p.Redis.PSubscribe(background, wsRoomKey("*"))
+		if _, err := pubsub.Receive(background); err != nil {
+			p.LogError(err) // 購読できない場合はこのノードのみに配信する
+			pubsub.Close()
+			return hub
+		}
+		hub.pubsub = pubsub
+		go func() {
+			for msg := range pubsub.Channel() {
+				hub.deliver(strings.TrimPrefix(msg.Channel, wsRoomKey("")), []byte(msg.Payload))
+			}
+		}()
+	}
+	return hub
+}
+
+// ルームにメッセージを配信する
+func (p *IHub) Broadcast(room string, data interface{}) error {
+	buf, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return p.publish(&IWsMessage{Type: WsTypeMessage, Room: room, Data: buf})
+}
+
+// ユーザの全接続にメッセージを配信する
+func (p *IHub) SendUser(userid string, data interface{}) error {
+	return p.Broadcast(wsUserRoom(userid), data)
+}
+
+func (p *IHub) publish(msg *IWsMessage) error {
+	buf, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if p.pubsub == nil {
+		p.deliver(msg.Room, buf)
+		return nil
+	}
+	return p.ex.Redis.Publish(background, wsRoomKey(msg.Room), buf).Err()
+}
+
+// このノードのルーム参加者に送信する
+func (p *IHub) deliver(room string, buf []byte) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	for client := range p.rooms[room] {
+		client.write(buf)
+	}
+}
+
+func (p *IHub) Join(client *IWsClient, room string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.rooms[room] == nil {
+		p.rooms[room] = map[*IWsClient]bool{}
+	}
+	p.rooms[room][client] = true
+	client.rooms[room] = true
+}
+
+func (p *IHub) Leave(client *IWsClient, room string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.leave(client, room)
+}
+
+func (p *IHub) leave(client *IWsClient, room string) {
+	delete(p.rooms[room], client)
+	if len(p.rooms[room]) == 0 {
+		delete(p.rooms, room)
+	}
+	delete(client.rooms, room)
+}
+
+// ルームに参加しているかどうか
+func (p *IHub) IsMember(client *IWsClient, room string) bool {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return client.rooms[room]
+}
+
+// 接続数
+func (p *IHub) Count() int {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return len(p.clients)
+}
+
+func (p *IHub) register(client *IWsClient) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.closed {
+		return false
+	}
+	p.clients[client] = true
+	return true
+}
+
+func (p *IHub) unregister(client *IWsClient) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for room := range client.rooms {
+		p.leave(client, room)
+	}
+	delete(p.clients, client)
+}
+
+// 購読を止めて全接続を閉じる
+func (p *IHub) Close() {
+	p.mutex.Lock()
+	p.closed = true
+	clients := []*IWsClient{}
+	for client := range p.clients {
+		clients = append(clients, client)
+	}
+	p.mutex.Unlock()
+	if p.pubsub != nil {
+		p.pubsub.Close()
+	}
+	for _, client := range clients {
+		client.close()
+	}
+}
+
+// 送信待ちに追加する 詰まっているクライアントは切断する
+func (p *IWsClient) write(buf []byte) {
+	select {
+	case p.send <- buf:
+	case <-p.done:
+	default:
+		p.close()
+	}
+}
+
+func (p *IWsClient) close() {
+	p.once.Do(func() {
+		close(p.done)
+	})
+}
+
+func (p *IWsClient) error(message string) {
+	buf, _ := json.Marshal(&IWsMessage{Type: WsTypeError, Data: json.RawMessage(fmt.Sprintf("%q", message))})
+	p.write(buf)
+}
+
+// 送信は1つのgoroutineで行う
+func (p *IWsClient) writer(stopped chan struct{}) {
+	defer close(stopped)
+	ticker := time.NewTicker(WsPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case buf := <-p.send:
+			p.conn.SetWriteDeadline(time.Now().Add(WsPingInterval))
+			if err := p.conn.WriteMessage(websocket.TextMessage, buf); err != nil {
+				p.close()
+				return
+			}
+		case <-ticker.C:
+			if err := p.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(WsPingInterval)); err != nil {
+				p.close()
+				return
+			}
+		case <-p.done:
+			// 受信側のReadMessageを終わらせる
+			p.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(time.Second))
+			p.conn.SetReadDeadline(time.Now().Add(time.Second))
+			return
+		}
+	}
+}
+
+// WebSocketのハンドラ 認証済み(useridあり)の場合のみ接続する
+func (p *IFiberEx) WebSocketHandler() fiber.Handler {
+	if p.Hub == nil {
+		p.Hub = p.NewHub()
+	}
+	upgrade := websocket.New(p.Hub.serve)
+	return func(c *fiber.Ctx) error {
+		if userid, _ := c.Locals("userid").(string); len(userid) == 0 || userid == "-" {
+			return p.ResultAppError(c, E40101.Wrap(fmt.Errorf("websocket requires authentication")))
+		}
+		if !websocket.IsWebSocketUpgrade(c) {
+			return fiber.ErrUpgradeRequired
+		}
+		if p.IsShuttingDown() {
+			return c.SendStatus(fiber.StatusServiceUnavailable)
+		}
+		return upgrade(c)
+	}
+}
+
+func (p *IHub) serve(conn *websocket.Conn) {
+	client := &IWsClient{
+		Id:     uuid.NewString(),
+		UserId: conn.Locals("userid").(string),
+		conn:   conn,
+		send:   make(chan []byte, WsSendBuffer),
+		done:   make(chan struct{}),
+		rooms:  map[string]bool{},
+	}
+	requestid, _ := conn.Locals("requestid").(string)
+	log := p.ex.Log.With(
+		zap.String("client", client.Id),
+		zap.String("userid", client.UserId),
+		zap.String("requestid", requestid),
+		zap.String("ip", conn.RemoteAddr().String()),
+	)
+	if !p.register(client) {
+		return
+	}
+	start := time.Now()
+	p.Join(client, wsUserRoom(client.UserId))
+	log.Info("websocket: connected")
+
+	stopped := make(chan struct{})
+	go client.writer(stopped)
+	defer func() {
+		p.unregister(client)
+		client.close()
+		<-stopped
+		log.Info("websocket: disconnected", zap.String("elaps", time.Since(start).String()))
+	}()
+
+	conn.SetReadDeadline(time.Now().Add(2 * WsPingInterval))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * WsPingInterval))
+	})
+	for {
+		_, buf, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Warn("websocket: " + err.Error())
+			}
+			return
+		}
+		msg := &IWsMessage{}
+		if err := json.Unmarshal(buf, msg); err != nil {
+			client.error("invalid message")
+			continue
+		}
+		if len(msg.Room) == 0 || strings.HasPrefix(msg.Room, wsUserRoom("")) {
+			client.error("invalid room")
+			continue
+		}
+		switch msg.Type {
+		case WsTypeJoin:
+			if p.OnJoin != nil {
+				if err := p.OnJoin(client, msg.Room); err != nil {
+					client.error(err.Error())
+					continue
+				}
+			}
+			p.Join(client, msg.Room)
+			log.Info("websocket: join", zap.String("room", msg.Room))
+		case WsTypeLeave:
+			p.Leave(client, msg.Room)
+			log.Info("websocket: leave", zap.String("room", msg.Room))
+		case WsTypeMessage:
+			if !p.IsMember(client, msg.Room) {
+				client.error("not joined")
+				continue
+			}
+			msg.UserId = client.UserId
+			if p.OnMessage != nil {
+				err = p.OnMessage(client, msg)
+			} else {
+				err = p.publish(msg)
+			}
+			if err != nil {
+				p.ex.LogError(err, zap.String("client", client.Id), zap.String("room", msg.Room))
+				client.error(err.Error())
+			}
+		default:
+			client.error("invalid type")
+		}
+	}
+}
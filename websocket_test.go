@@ -0,0 +1,90 @@
+package fiberextend_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/websocket"
+	ext "github.com/h-nosaka/fiberextend"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestWebSocket(t *testing.T) {
+	test := ext.NewTest(t, ext.IFiberExConfig{
+		UseJwt:       true,
+		SecretToken:  "secret",
+		UseRedis:     true,
+		RedisOptions: &redis.Options{},
+		UseWebSocket: true,
+	})
+	dial := func(userid string) *websocket.Conn {
+		token, err := test.Ex.IssueToken(userid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return test.WebSocket("/ws", map[string]string{"Authorization": "Bearer " + token.AccessToken})
+	}
+	send := func(conn *websocket.Conn, msg *ext.IWsMessage) {
+		if err := conn.WriteJSON(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	receive := func(conn *websocket.Conn) *ext.IWsMessage {
+		conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+		msg := &ext.IWsMessage{}
+		if err := conn.ReadJSON(msg); err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+
+	test.Run("unauthorized", func() {
+		test.Api("no token", &ext.ITestRequest{Method: "GET", Path: "/ws"}, 401,
+			&ext.ITestCase{Path: "error.0.code", Want: "E40101"})
+	})
+
+	user1 := dial("user1")
+	user2 := dial("user2")
+	test.Run("room", func() {
+		send(user1, &ext.IWsMessage{Type: ext.WsTypeJoin, Room: "room1"})
+		send(user2, &ext.IWsMessage{Type: ext.WsTypeJoin, Room: "room1"})
+		send(user2, &ext.IWsMessage{Type: ext.WsTypeMessage, Room: "room2", Data: json.RawMessage(`"hello"`)})
+		if msg := receive(user2); msg.Type != ext.WsTypeError {
+			t.Errorf("not joined: %+v", msg)
+		}
+		send(user1, &ext.IWsMessage{Type: ext.WsTypeMessage, Room: "room1", Data: json.RawMessage(`"hello"`)})
+		for _, conn := range []*websocket.Conn{user1, user2} {
+			msg := receive(conn)
+			if msg.Room != "room1" || msg.UserId != "user1" || string(msg.Data) != `"hello"` {
+				t.Errorf("message: %+v", msg)
+			}
+		}
+	})
+	test.Run("cross node", func() {
+		// 同じRedisに接続した別ノードから配信する
+		other := ext.New(ext.IFiberExConfig{
+			TestMode:     ext.Bool(true),
+			UseRedis:     true,
+			RedisOptions: &redis.Options{Addr: test.Redis.Addr()},
+		})
+		hub := other.NewHub()
+		defer hub.Close()
+		if err := hub.SendUser("user2", map[string]string{"notice": "done"}); err != nil {
+			t.Fatal(err)
+		}
+		if msg := receive(user2); string(msg.Data) != `{"notice":"done"}` {
+			t.Errorf("message: %+v", msg)
+		}
+	})
+	test.Run("shutdown", func() {
+		if count := test.Ex.Hub.Count(); count != 2 {
+			t.Errorf("count: %d", count)
+		}
+		test.Ex.Hub.Close()
+		user1.SetReadDeadline(time.Now().Add(3 * time.Second))
+		if _, _, err := user1.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+			t.Errorf("close: %v", err)
+		}
+	})
+}